@@ -2,23 +2,90 @@ package cmd
 
 type GlobalConfiguration struct {
 	PollConfig
-	LogLevel string `short:"l" description:"Log level"`
+	HistoryConfig
+	LogLevel  string `short:"l" description:"Log level"`
+	Agent     bool   `description:"Run as agent, only serving resource usage of the tasks on this node"`
+	AgentPort int    `description:"Port of the dvizz agents running on the other nodes. 0 collects stats from the local node only"`
+	ApiToken  string `short:"a" description:"Bearer token required by API endpoints that modify the swarm. Those endpoints are disabled when empty"`
+}
+
+type HistoryConfig struct {
+	History          string `description:"File keeping the history of events and snapshots, such as /data/dvizz.db. No history is kept when empty, the default"`
+	HistoryRetention int    `description:"Hours to keep events and snapshots for"`
+	SnapshotInterval int    `description:"Snapshot interval, seconds"`
 }
 
 type PollConfig struct {
-	NodePoll    int `short:"n" description:"Node poll interval, seconds"`
-	ServicePoll int `short:"s" description:"Service poll interval, seconds"`
-	TaskPoll    int `short:"t" description:"Task poll interval, seconds"`
+	NodePoll     int `short:"n" description:"Node poll interval, seconds"`
+	ServicePoll  int `short:"s" description:"Service poll interval, seconds"`
+	TaskPoll     int `short:"t" description:"Task poll interval, seconds"`
+	NetworkPoll  int `description:"Network poll interval, seconds"`
+	ResourcePoll int `description:"Secret, config and volume poll interval, seconds"`
+	StatsPoll    int `description:"Task resource usage poll interval, seconds. 0 disables stats"`
 }
 
 func DefaultConfiguration() *GlobalConfiguration {
 
 	return &GlobalConfiguration{
 		LogLevel: "info",
+		HistoryConfig: HistoryConfig{
+			HistoryRetention: 24 * 7,
+			SnapshotInterval: 300,
+		},
 		PollConfig: PollConfig{
-			NodePoll:    60,
-			ServicePoll: 30,
-			TaskPoll:    10,
+			NodePoll:     60,
+			ServicePoll:  30,
+			TaskPoll:     10,
+			NetworkPoll:  30,
+			ResourcePoll: 60,
+			StatsPoll:    15,
 		},
 	}
 }
+
+type ExportConfiguration struct {
+	Format string `short:"f" description:"Graph format: dot, graphml, mermaid or cytoscape"`
+	Output string `short:"o" description:"File to write the graph to. Written to stdout when empty"`
+	Stack  string `description:"Only export the services and tasks of this stack"`
+}
+
+func DefaultExportConfiguration() *ExportConfiguration {
+	return &ExportConfiguration{Format: "dot"}
+}
+
+// TuiConfiguration configures the terminal front end.
+type TuiConfiguration struct {
+	PollConfig
+	Url     string `short:"u" description:"Address of a dvizz server to follow, such as http://manager:6969. The local Docker client is polled when empty"`
+	Refresh int    `description:"Seconds between redraws when nothing changes"`
+}
+
+func DefaultTuiConfiguration() *TuiConfiguration {
+	return &TuiConfiguration{PollConfig: DefaultConfiguration().PollConfig, Refresh: 1}
+}
+
+// SnapshotConfiguration configures printing the model once.
+type SnapshotConfiguration struct {
+	Url    string `short:"u" description:"Address of a dvizz server to ask, such as http://manager:6969. The local Docker client is asked when empty"`
+	Format string `short:"f" description:"Output format: json, yaml or table"`
+	Stack  string `description:"Only print the services and tasks of this stack"`
+}
+
+func DefaultSnapshotConfiguration() *SnapshotConfiguration {
+	return &SnapshotConfiguration{Format: "table"}
+}
+
+// WatchConfiguration configures printing the changes of the model as they happen.
+type WatchConfiguration struct {
+	PollConfig
+	Url     string   `short:"u" description:"Address of a dvizz server to follow, such as http://manager:6969. The local Docker client is polled when empty"`
+	Format  string   `short:"f" description:"Output format: text, or json for one event per line"`
+	Type    []string `description:"Only print events of these types, such as task or service"`
+	Action  []string `description:"Only print events with these actions, such as start or stop"`
+	Service string   `description:"Only print the events of this service and its tasks, by name or id"`
+	Stack   string   `description:"Only print the events of the services and tasks of this stack"`
+}
+
+func DefaultWatchConfiguration() *WatchConfiguration {
+	return &WatchConfiguration{PollConfig: DefaultConfiguration().PollConfig, Format: "text"}
+}
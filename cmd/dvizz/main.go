@@ -1,7 +1,8 @@
-/**
+/*
+*
 The MIT License (MIT)
 
-Copyright (c) 2016 ErikL
+# Copyright (c) 2016 ErikL
 
 Permission is hereby granted, free of charge, to any person obtaining a copy
 of this software and associated documentation files (the "Software"), to deal
@@ -24,20 +25,32 @@ SOFTWARE.
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/containous/flaeg"
 	"github.com/containous/flaeg/parse"
 	"github.com/eriklupander/dvizz/cmd"
+	"github.com/eriklupander/dvizz/internal/pkg/cli"
 	"github.com/eriklupander/dvizz/internal/pkg/comms"
+	"github.com/eriklupander/dvizz/internal/pkg/export"
+	"github.com/eriklupander/dvizz/internal/pkg/history"
 	"github.com/eriklupander/dvizz/internal/pkg/service"
+	"github.com/eriklupander/dvizz/internal/pkg/tui"
+	"github.com/eriklupander/dvizz/pkg/client"
+	"github.com/eriklupander/dvizz/pkg/model"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/ogier/pflag"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+	"io/ioutil"
 	fmtlog "log"
 	"os"
+	"os/signal"
 	"reflect"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 type dvizzConfiguration struct {
@@ -69,7 +82,55 @@ func main() {
 		},
 	}
 
+	exportConfiguration := cmd.DefaultExportConfiguration()
+	exportCommand := &flaeg.Command{
+		Name:                  "export",
+		Description:           "Writes the nodes, services, tasks and networks of the swarm as a graph file",
+		Config:                exportConfiguration,
+		DefaultPointersConfig: &cmd.ExportConfiguration{},
+		Run: func() error {
+			return runExport(exportConfiguration)
+		},
+	}
+
+	tuiConfiguration := cmd.DefaultTuiConfiguration()
+	tuiCommand := &flaeg.Command{
+		Name:                  "tui",
+		Description:           "Draws the swarm in the terminal, following the local Docker client or a dvizz server",
+		Config:                tuiConfiguration,
+		DefaultPointersConfig: &cmd.TuiConfiguration{},
+		Run: func() error {
+			return runTui(tuiConfiguration)
+		},
+	}
+
+	snapshotConfiguration := cmd.DefaultSnapshotConfiguration()
+	snapshotCommand := &flaeg.Command{
+		Name:                  "snapshot",
+		Description:           "Prints the nodes, services, tasks and networks of the swarm",
+		Config:                snapshotConfiguration,
+		DefaultPointersConfig: &cmd.SnapshotConfiguration{},
+		Run: func() error {
+			return runSnapshot(snapshotConfiguration)
+		},
+	}
+
+	watchConfiguration := cmd.DefaultWatchConfiguration()
+	watchCommand := &flaeg.Command{
+		Name:                  "watch",
+		Description:           "Prints the changes of the swarm as they happen, following the local Docker client or a dvizz server",
+		Config:                watchConfiguration,
+		DefaultPointersConfig: &cmd.WatchConfiguration{},
+		Run: func() error {
+			return runWatch(watchConfiguration)
+		},
+	}
+
 	f := flaeg.New(mainCommand, os.Args[1:])
+	f.AddCommand(exportCommand)
+	f.AddCommand(tuiCommand)
+	f.AddCommand(snapshotCommand)
+	f.AddCommand(watchCommand)
 	f.AddParser(reflect.TypeOf([]string{}), &parse.SliceStrings{})
 
 	usedCmd, err := f.GetCommand()
@@ -101,10 +162,33 @@ func run(cfg *dvizzConfiguration) {
 		panic(err)
 	}
 
-	eventServer := &comms.EventServer{Client: dockerClient}
-	go eventServer.InitializeEventSystem()
+	statsCollector := service.NewStatsCollector(dockerClient)
+	eventServer := &comms.EventServer{Client: dockerClient, ApiToken: cfg.ApiToken, Stats: statsCollector}
 
+	if cfg.Agent {
+		logrus.Infof("Running as agent")
+		eventServer.InitializeAgent()
+		return
+	}
 	publisher := service.NewPublisher(eventServer, &cfg.GlobalConfiguration)
+	eventServer.Model = publisher
+
+	if cfg.History != "" {
+		store, err := history.Open(cfg.History, time.Hour*time.Duration(cfg.HistoryRetention))
+		if err != nil {
+			// The swarm is still worth showing without its history
+			logrus.Errorf("Keeping no history, could not open %v: %v", cfg.History, err)
+		} else {
+			// Closed by the event server on SIGTERM
+			eventServer.History = store
+			go func() {
+				publisher.Seeded()
+				store.Run(publisher, time.Second*time.Duration(cfg.SnapshotInterval))
+			}()
+			logrus.Infof("Keeping history in %v for %v hours, snapshot every %v seconds", cfg.History, cfg.HistoryRetention, cfg.SnapshotInterval)
+		}
+	}
+	go eventServer.InitializeEventSystem()
 
 	go publisher.PublishTasks(dockerClient)
 	logrus.Infof("Initialized publishTasks, will poll every %v seconds", cfg.TaskPoll)
@@ -115,6 +199,23 @@ func run(cfg *dvizzConfiguration) {
 	go publisher.PublishNodes(dockerClient)
 	logrus.Infof("Initialized publishNodes, will poll every %v seconds", cfg.NodePoll)
 
+	go publisher.PublishNetworks(dockerClient)
+	logrus.Infof("Initialized publishNetworks, will poll every %v seconds", cfg.NetworkPoll)
+
+	go publisher.PublishGraph()
+	logrus.Infof("Initialized publishGraph, will derive the service graph every %v seconds", cfg.NetworkPoll)
+
+	go publisher.PublishStacks()
+	logrus.Infof("Initialized publishStacks, will derive stacks every %v seconds", cfg.ServicePoll)
+
+	go publisher.PublishResources(dockerClient)
+	logrus.Infof("Initialized publishResources, will poll every %v seconds", cfg.ResourcePoll)
+
+	if cfg.StatsPoll > 0 {
+		go publisher.PublishStats(dockerClient, statsCollector)
+		logrus.Infof("Initialized publishStats, will poll every %v seconds", cfg.StatsPoll)
+	}
+
 	// Block...
 	logrus.Println("Waiting at block...")
 
@@ -123,6 +224,30 @@ func run(cfg *dvizzConfiguration) {
 	wg.Wait()
 }
 
+func runExport(cfg *cmd.ExportConfiguration) error {
+	dockerClient, err := docker.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+	snapshot, err := service.TakeSnapshot(dockerClient)
+	if err != nil {
+		return err
+	}
+	if cfg.Stack != "" {
+		snapshot = export.ForStack(snapshot, cfg.Stack)
+	}
+
+	out := os.Stdout
+	if cfg.Output != "" {
+		out, err = os.Create(cfg.Output)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	return export.Render(out, cfg.Format, snapshot)
+}
+
 // ConfigureLogging Configure logging for all cmd.
 func configureLogging(configuration *dvizzConfiguration) {
 	// configure default log flags
@@ -149,3 +274,161 @@ func configureLogging(configuration *dvizzConfiguration) {
 		FullTimestamp: true,
 	})
 }
+
+func runTui(cfg *cmd.TuiConfiguration) error {
+	fd := int(os.Stdout.Fd())
+	if !terminal.IsTerminal(fd) {
+		return fmt.Errorf("the terminal UI needs a terminal")
+	}
+	// Log lines would garble the screen
+	logrus.SetOutput(ioutil.Discard)
+
+	var ui *tui.UI
+	if cfg.Url != "" {
+		c, err := client.New(cfg.Url)
+		if err != nil {
+			return err
+		}
+		c.Logf = logrus.Warnf
+		ui = tui.New(os.Stdout, c)
+		c.OnChange(func(e client.Event) {
+			if e.Type != "stats" {
+				ui.Add(tui.EntryOf(e))
+			}
+		})
+		go c.Run(context.Background())
+	} else {
+		dockerClient, err := docker.NewClientFromEnv()
+		if err != nil {
+			return err
+		}
+		global := cmd.DefaultConfiguration()
+		global.PollConfig = cfg.PollConfig
+		feed := &tui.Feed{}
+		publisher := service.NewPublisher(feed, global)
+		ui = tui.New(os.Stdout, publisher)
+		feed.UI = ui
+		go publisher.PublishTasks(dockerClient)
+		go publisher.PublishServices(dockerClient)
+		go publisher.PublishNodes(dockerClient)
+		go publisher.PublishNetworks(dockerClient)
+	}
+
+	ui.Size = func() (int, int) {
+		width, height, err := terminal.GetSize(fd)
+		if err != nil {
+			return 80, 24
+		}
+		return width, height
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Keys pressed are neither echoed nor wait for a new line. Restored once the UI stopped, on every way out
+	if in := int(os.Stdin.Fd()); terminal.IsTerminal(in) {
+		state, err := terminal.MakeRaw(in)
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(in, state)
+		go tui.ReadKeys(os.Stdin, cancel)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	refresh := time.Second * time.Duration(cfg.Refresh)
+	if refresh <= 0 {
+		refresh = time.Second
+	}
+	ui.Run(ctx, refresh)
+	return nil
+}
+
+func runSnapshot(cfg *cmd.SnapshotConfiguration) error {
+	var snapshot model.DSnapshot
+	if cfg.Url != "" {
+		c, err := client.New(cfg.Url)
+		if err != nil {
+			return err
+		}
+		if err := c.Load(context.Background()); err != nil {
+			return err
+		}
+		snapshot = c.Snapshot()
+	} else {
+		dockerClient, err := docker.NewClientFromEnv()
+		if err != nil {
+			return err
+		}
+		if snapshot, err = service.TakeSnapshot(dockerClient); err != nil {
+			return err
+		}
+	}
+	if cfg.Stack != "" {
+		snapshot = export.ForStack(snapshot, cfg.Stack)
+	}
+	return cli.WriteSnapshot(os.Stdout, cfg.Format, snapshot)
+}
+
+func runWatch(cfg *cmd.WatchConfiguration) error {
+	if cfg.Format != cli.FormatText && cfg.Format != cli.FormatLines {
+		return fmt.Errorf("unknown format %q, expected text or json", cfg.Format)
+	}
+	// Only events go to stdout, for them to be piped
+	logrus.SetOutput(os.Stderr)
+
+	printer := &cli.Printer{
+		Out:    os.Stdout,
+		Format: cfg.Format,
+		Filter: cli.Filter{Types: cfg.Type, Actions: cfg.Action, Service: cfg.Service, Stack: cfg.Stack},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	if cfg.Url != "" {
+		c, err := client.New(cfg.Url)
+		if err != nil {
+			return err
+		}
+		c.Logf = logrus.Warnf
+		printer.Source = c
+		c.OnChange(func(e client.Event) {
+			if e.Type == "snapshot" {
+				printer.Reset()
+				return
+			}
+			event := client.Envelope{Version: model.EnvelopeVersion, Seq: e.Seq, Timestamp: e.Time, Type: e.Type, Action: e.Action, Payload: e.Payload}
+			if err := printer.Print(event); err != nil {
+				logrus.Warnf("problem printing event: %v", err)
+			}
+		})
+		if err := c.Run(ctx); err != context.Canceled {
+			return err
+		}
+		return nil
+	}
+
+	dockerClient, err := docker.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+	global := cmd.DefaultConfiguration()
+	global.PollConfig = cfg.PollConfig
+	publisher := service.NewPublisher(&cli.Feed{Printer: printer}, global)
+	printer.Source = publisher
+	go publisher.PublishTasks(dockerClient)
+	go publisher.PublishServices(dockerClient)
+	go publisher.PublishNodes(dockerClient)
+	go publisher.PublishNetworks(dockerClient)
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,116 @@
+// Package cli writes the model and its changes for the command line, for people and for scripts.
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/eriklupander/dvizz/internal/pkg/service"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"gopkg.in/yaml.v2"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Snapshot formats
+const (
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatTable = "table"
+)
+
+// WriteSnapshot writes the nodes, services, tasks and networks in the given format. JSON and YAML have the same
+// fields as the REST API.
+func WriteSnapshot(w io.Writer, format string, snapshot model.DSnapshot) error {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(&snapshot, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case FormatYAML:
+		// Through JSON, for the field names to be the same
+		data, err := json.Marshal(&snapshot)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case FormatTable:
+		return writeTable(w, snapshot)
+	}
+	return fmt.Errorf("unknown format %q, expected json, yaml or table", format)
+}
+
+func writeTable(w io.Writer, snapshot model.DSnapshot) error {
+	nodeNames := make(map[string]string)
+	for _, n := range snapshot.Nodes {
+		nodeNames[n.Id] = n.Name
+	}
+	serviceNames := make(map[string]string)
+	for _, s := range snapshot.Services {
+		serviceNames[s.Id] = s.Name
+	}
+
+	t := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(t, "NODE\tROLE\tSTATE\tAVAILABILITY\tADDRESS\tENGINE")
+	nodes := append([]model.DNode{}, snapshot.Nodes...)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, n := range nodes {
+		fmt.Fprintf(t, "%v\t%v\t%v\t%v\t%v\t%v\n", n.Name, n.Role, n.State, n.Availability, n.Addr, n.EngineVersion)
+	}
+
+	fmt.Fprintln(t, "\nSERVICE\tMODE\tREPLICAS\tHEALTH\tSTACK\tIMAGE")
+	replicas := service.Replicas(snapshot.Services, snapshot.Tasks)
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].Name < replicas[j].Name
+	})
+	services := make(map[string]model.DService)
+	for _, s := range snapshot.Services {
+		services[s.Id] = s
+	}
+	for _, r := range replicas {
+		s := services[r.Id]
+		fmt.Fprintf(t, "%v\t%v\t%v/%v\t%v\t%v\t%v\n", s.Name, s.Mode, r.Running, r.Desired, r.Health, s.Stack, s.Image)
+	}
+
+	fmt.Fprintln(t, "\nTASK\tSERVICE\tNODE\tSTATUS\tERROR")
+	tasks := append([]model.DTask{}, snapshot.Tasks...)
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Name < tasks[j].Name
+	})
+	for _, task := range tasks {
+		fmt.Fprintf(t, "%v\t%v\t%v\t%v\t%v\n", task.Name, serviceNames[task.ServiceId], nodeNames[task.NodeId], task.Status, task.Err)
+	}
+
+	fmt.Fprintln(t, "\nNETWORK\tDRIVER\tSCOPE\tSUBNETS\tSERVICES")
+	networks := append([]model.DSwarmNetwork{}, snapshot.Networks...)
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i].Name < networks[j].Name
+	})
+	for _, n := range networks {
+		subnets := make([]string, 0, len(n.Subnets))
+		for _, s := range n.Subnets {
+			subnets = append(subnets, s.Subnet)
+		}
+		attached := make([]string, 0, len(n.Services))
+		for _, id := range n.Services {
+			attached = append(attached, serviceNames[id])
+		}
+		fmt.Fprintf(t, "%v\t%v\t%v\t%v\t%v\n", n.Name, n.Driver, n.Scope, strings.Join(subnets, ","), strings.Join(attached, ","))
+	}
+	return t.Flush()
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func buildSnapshot() DSnapshot {
+	return DSnapshot{
+		Nodes:    []DNode{{Id: "n1", Name: "worker-1", Role: "worker", State: "ready", Availability: "active"}},
+		Services: []DService{{Id: "s1", Name: "shop_web", Stack: "shop", Image: "nginx:1.17", Mode: "replicated", Replicas: 1}},
+		Tasks:    []DTask{{Id: "t1", Name: "shop_web.1", Status: "running", DesiredState: "running", ServiceId: "s1", Stack: "shop", NodeId: "n1"}},
+		Networks: []DSwarmNetwork{{Id: "net1", Name: "shop_default", Driver: "overlay", Services: []string{"s1"}}},
+	}
+}
+
+func TestWriteSnapshotJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WriteSnapshot(buf, FormatJSON, buildSnapshot())
+	snapshot := DSnapshot{}
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(json.Unmarshal(buf.Bytes(), &snapshot), ShouldBeNil)
+		So(snapshot.Tasks[0].ServiceId, ShouldEqual, "s1")
+		So(snapshot.Networks[0].Services, ShouldResemble, []string{"s1"})
+	})
+}
+
+func TestWriteSnapshotYAML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WriteSnapshot(buf, FormatYAML, buildSnapshot())
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, "serviceId: s1")
+		So(buf.String(), ShouldContainSubstring, "name: worker-1")
+	})
+}
+
+func TestWriteSnapshotTable(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WriteSnapshot(buf, FormatTable, buildSnapshot())
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldStartWith, "NODE")
+		So(buf.String(), ShouldContainSubstring, "worker-1")
+		So(buf.String(), ShouldContainSubstring, "1/1")
+		So(buf.String(), ShouldContainSubstring, "nginx:1.17")
+		So(buf.String(), ShouldContainSubstring, "shop_web.1")
+		So(buf.String(), ShouldContainSubstring, "shop_default")
+	})
+}
+
+func TestWriteSnapshotUnknownFormat(t *testing.T) {
+	err := WriteSnapshot(&bytes.Buffer{}, "csv", buildSnapshot())
+	Convey("Assert", t, func() {
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/eriklupander/dvizz/internal/pkg/comms"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watch formats
+const (
+	FormatText  = "text"
+	FormatLines = "json" // one envelope per line
+)
+
+// Source tells the nodes and services events refer to by id, as of when the first event is printed.
+type Source interface {
+	Snapshot() model.DSnapshot
+}
+
+// Filter selects events. Empty fields select any event, except resource usage samples which are only selected by
+// type.
+type Filter struct {
+	Types   []string
+	Actions []string
+	Service string // id or name of a service, selecting the events of the service and of its tasks
+	Stack   string // selecting the events of the services, tasks and the stack itself
+}
+
+// Printer writes the events selected by its filter, as text lines for people or as JSON lines for scripts. Events
+// are printed one at a time.
+type Printer struct {
+	Out    io.Writer
+	Format string
+	Filter Filter
+	Source Source
+	// The names of the services and nodes by id, loaded from Source and then kept up to date from the events, as
+	// Source may not include the changes of an event yet
+	services map[string]string
+	nodes    map[string]string
+}
+
+// payload holds what filters and text lines need from the payload of any event.
+type payload struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	ServiceId    string `json:"serviceId"`
+	NodeId       string `json:"nodeId"`
+	Stack        string `json:"stack"`
+	Status       string `json:"status"`
+	Err          string `json:"err"`
+	Image        string `json:"image"`
+	State        string `json:"state"`
+	Availability string `json:"availability"`
+	Health       string `json:"health"`
+}
+
+// Print writes the event if the filter selects it.
+func (p *Printer) Print(event model.DEnvelope) error {
+	var entity payload
+	json.Unmarshal(event.Payload, &entity)
+	p.track(event, entity)
+	if !p.Filter.matches(event, entity, p.services) {
+		return nil
+	}
+
+	if p.Format == FormatLines {
+		data, err := json.Marshal(&event)
+		if err != nil {
+			return err
+		}
+		_, err = p.Out.Write(append(data, '\n'))
+		return err
+	}
+
+	name := entity.Name
+	if name == "" {
+		name = entity.Id
+	}
+	line := fmt.Sprintf("%v %-8v %-8v %v", event.Timestamp.Format(time.RFC3339), event.Type, event.Action, name)
+	if detail := describe(event.Type, entity, p.nodes); detail != "" {
+		line += "  " + detail
+	}
+	_, err := fmt.Fprintln(p.Out, line)
+	return err
+}
+
+// Reset forgets the names of the services and nodes, for them to be loaded from Source again by the next event.
+func (p *Printer) Reset() {
+	p.services, p.nodes = nil, nil
+}
+
+// track keeps the names of the services and nodes up to date with an event.
+func (p *Printer) track(event model.DEnvelope, entity payload) {
+	if p.services == nil {
+		p.services, p.nodes = make(map[string]string), make(map[string]string)
+		if p.Source != nil {
+			snapshot := p.Source.Snapshot()
+			for _, s := range snapshot.Services {
+				p.services[s.Id] = s.Name
+			}
+			for _, n := range snapshot.Nodes {
+				p.nodes[n.Id] = n.Name
+			}
+		}
+	}
+	var names map[string]string
+	switch event.Type {
+	case "service":
+		names = p.services
+	case "node":
+		names = p.nodes
+	default:
+		return
+	}
+	if event.Action == model.ActionStop {
+		delete(names, entity.Id)
+	} else {
+		names[entity.Id] = entity.Name
+	}
+}
+
+func (f Filter) matches(event model.DEnvelope, entity payload, services map[string]string) bool {
+	if len(f.Types) > 0 && !contains(f.Types, event.Type) || len(f.Types) == 0 && event.Type == "stats" {
+		return false
+	}
+	if len(f.Actions) > 0 && !contains(f.Actions, string(event.Action)) {
+		return false
+	}
+	if f.Service != "" {
+		var serviceId string
+		switch event.Type {
+		case "service":
+			serviceId = entity.Id
+		case "task":
+			serviceId = entity.ServiceId
+		default:
+			return false
+		}
+		if serviceId != f.Service && services[serviceId] != f.Service && !(event.Type == "service" && entity.Name == f.Service) {
+			return false
+		}
+	}
+	if f.Stack != "" {
+		switch event.Type {
+		case "service", "task":
+			return entity.Stack == f.Stack
+		case "stack":
+			return entity.Name == f.Stack
+		}
+		return false
+	}
+	return true
+}
+
+// describe tells the state of tasks, services and nodes for text lines, given the names of the nodes by id.
+func describe(typ string, entity payload, nodes map[string]string) string {
+	switch typ {
+	case "task":
+		detail := entity.Status
+		if name, ok := nodes[entity.NodeId]; ok {
+			detail += " on " + name
+		}
+		if entity.Err != "" {
+			detail += ": " + entity.Err
+		}
+		return detail
+	case "service":
+		return entity.Image
+	case "node":
+		return strings.TrimSpace(entity.State + " " + entity.Availability)
+	case "stack":
+		return entity.Health
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Feed is the event server of a publisher running in process, printing the events published.
+type Feed struct {
+	Printer *Printer
+	lock    sync.Mutex
+	seq     uint64
+}
+
+func (f *Feed) AddEventToSendQueue(data []byte) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.seq++
+	if err := f.Printer.Print(comms.Envelope(data, f.seq, time.Now())); err != nil {
+		logrus.Warnf("problem printing event: %v", err)
+	}
+}
+
+func (f *Feed) InitializeEventSystem() {}
+
+func (f *Feed) Close() {}
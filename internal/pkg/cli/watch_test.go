@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+type snapshotSource DSnapshot
+
+func (s snapshotSource) Snapshot() DSnapshot {
+	return DSnapshot(s)
+}
+
+func event(typ string, action Action, payload interface{}) DEnvelope {
+	data, _ := json.Marshal(payload)
+	return DEnvelope{Version: EnvelopeVersion, Seq: 1, Timestamp: time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC), Type: typ, Action: action, Payload: data}
+}
+
+func printAll(filter Filter, format string, events ...DEnvelope) string {
+	buf := &bytes.Buffer{}
+	printer := &Printer{Out: buf, Format: format, Filter: filter, Source: snapshotSource(buildSnapshot())}
+	for _, e := range events {
+		printer.Print(e)
+	}
+	return buf.String()
+}
+
+func TestWatchText(t *testing.T) {
+	out := printAll(Filter{}, FormatText, event("task", ActionStop, DTask{Id: "t1", Name: "shop_web.1", Status: "failed", Err: "exit 1", NodeId: "n1"}))
+	Convey("Assert", t, func() {
+		So(out, ShouldStartWith, "2019-05-01T12:00:00Z task")
+		So(out, ShouldContainSubstring, "shop_web.1  failed on worker-1: exit 1")
+	})
+}
+
+func TestWatchJSONLines(t *testing.T) {
+	out := printAll(Filter{}, FormatLines,
+		event("task", ActionStart, DTask{Id: "t1"}),
+		event("service", ActionUpdate, DService{Id: "s1"}))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	first := DEnvelope{}
+	Convey("Assert", t, func() {
+		So(len(lines), ShouldEqual, 2)
+		So(json.Unmarshal([]byte(lines[0]), &first), ShouldBeNil)
+		So(first.Type, ShouldEqual, "task")
+		So(first.Action, ShouldEqual, ActionStart)
+	})
+}
+
+func TestWatchFilters(t *testing.T) {
+	events := []DEnvelope{
+		event("task", ActionStart, DTask{Id: "t1", Name: "shop_web.1", ServiceId: "s1", Stack: "shop"}),
+		event("task", ActionStop, DTask{Id: "t2", Name: "monitor.1", ServiceId: "s2"}),
+		event("service", ActionUpdate, DService{Id: "s1", Name: "shop_web", Stack: "shop"}),
+		event("node", ActionUpdate, DNode{Id: "n1", Name: "worker-1"}),
+		event("stats", ActionUpdate, DTaskStats{TaskId: "t1"}),
+	}
+	Convey("Given a stream of events", t, func() {
+		Convey("Resource usage is only printed when asked for", func() {
+			So(strings.Count(printAll(Filter{}, FormatText, events...), "\n"), ShouldEqual, 4)
+			So(strings.Count(printAll(Filter{Types: []string{"stats"}}, FormatText, events...), "\n"), ShouldEqual, 1)
+		})
+		Convey("Types and actions select events", func() {
+			out := printAll(Filter{Types: []string{"task"}, Actions: []string{"stop"}}, FormatText, events...)
+			So(out, ShouldContainSubstring, "monitor.1")
+			So(strings.Count(out, "\n"), ShouldEqual, 1)
+		})
+		Convey("A service selects itself and its tasks, by name", func() {
+			out := printAll(Filter{Service: "shop_web"}, FormatText, events...)
+			So(out, ShouldContainSubstring, "shop_web.1")
+			So(out, ShouldContainSubstring, "service  update")
+			So(strings.Count(out, "\n"), ShouldEqual, 2)
+		})
+		Convey("A stack selects its services and tasks", func() {
+			out := printAll(Filter{Stack: "shop"}, FormatText, events...)
+			So(out, ShouldNotContainSubstring, "monitor")
+			So(out, ShouldNotContainSubstring, "worker-1")
+			So(strings.Count(out, "\n"), ShouldEqual, 2)
+		})
+	})
+}
+
+// countingSource counts the snapshots taken.
+type countingSource struct {
+	snapshots int
+}
+
+func (s *countingSource) Snapshot() DSnapshot {
+	s.snapshots++
+	return buildSnapshot()
+}
+
+func TestWatchTracksServicesStarted(t *testing.T) {
+	Convey("Given a service started after the source was read", t, func() {
+		buf := &bytes.Buffer{}
+		source := &countingSource{}
+		printer := &Printer{Out: buf, Format: FormatText, Filter: Filter{Service: "shop_api"}, Source: source}
+		printer.Print(event("service", ActionStart, DService{Id: "s3", Name: "shop_api"}))
+
+		Convey("When its task is started", func() {
+			printer.Print(event("task", ActionStart, DTask{Id: "t3", Name: "shop_api.1", ServiceId: "s3", NodeId: "n1", Status: "running"}))
+
+			Convey("Then the task is selected by the name of its service, reading the source once", func() {
+				So(buf.String(), ShouldContainSubstring, "shop_api.1  running on worker-1")
+				So(strings.Count(buf.String(), "\n"), ShouldEqual, 2)
+				So(source.snapshots, ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,273 @@
+package comms
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/eriklupander/dvizz/pkg/model"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Docker has no API for pausing an update; the swarm only pauses one itself when its failure action is pause.
+var errPauseUnsupported = errors.New("the Docker API cannot pause an update, only resume one the swarm paused")
+
+const (
+	jobPollInterval = time.Second
+	jobTimeout      = time.Minute * 15
+)
+
+// jobRegistry keeps track of the jobs started through the API.
+type jobRegistry struct {
+	sync.RWMutex
+	jobs map[string]*model.DJob
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*model.DJob)}
+}
+
+func (r *jobRegistry) put(job model.DJob) {
+	r.Lock()
+	defer r.Unlock()
+	r.jobs[job.Id] = &job
+}
+
+func (r *jobRegistry) get(id string) (model.DJob, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return model.DJob{}, false
+	}
+	return *job, true
+}
+
+// serviceAction handles POST /api/services/{id}/{action}, returning the job tracking the action.
+func (server *EventServer) serviceAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	params := pathParams("/api/services/", r.URL.Path)
+	if len(params) != 2 {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	serviceId, action := params[0], model.Action(params[1])
+
+	svc, err := server.Client.InspectService(serviceId)
+	if err != nil {
+		if _, ok := err.(*docker.NoSuchService); ok {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	opts, err := updateOptionsFor(action, svc)
+	if err == errPauseUnsupported {
+		http.Error(w, err.Error(), 501)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 409)
+		return
+	}
+	if err := server.Client.UpdateService(svc.ID, opts); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	job := model.DJob{
+		Id:        newId(),
+		Action:    action,
+		ServiceId: svc.ID,
+		State:     "running",
+		Tasks:     make(map[string]int),
+		Started:   time.Now(),
+	}
+	server.jobs.put(job)
+	server.AddEventToSendQueue(marshal(&model.DJobEvent{Action: model.ActionStart, Type: "job", Djob: job}))
+	logrus.Infof("Started job %v: %v of service %v", job.Id, action, svc.Spec.Name)
+
+	go server.watchJob(job)
+
+	data, _ := json.Marshal(&job)
+	writeResponse(w, data)
+}
+
+// getJob handles GET /api/jobs/{id}.
+func (server *EventServer) getJob(w http.ResponseWriter, r *http.Request) {
+	params := pathParams("/api/jobs/", r.URL.Path)
+	if len(params) != 1 {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	job, ok := server.jobs.get(params[0])
+	if !ok {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	data, _ := json.Marshal(&job)
+	writeResponse(w, data)
+}
+
+// updateOptionsFor validates the current UpdateStatus of the service and builds the update for the action.
+func updateOptionsFor(action model.Action, svc *swarm.Service) (docker.UpdateServiceOptions, error) {
+	state := updateState(svc)
+	opts := docker.UpdateServiceOptions{ServiceSpec: svc.Spec, Version: svc.Version.Index}
+
+	switch action {
+	case model.ActionForceUpdate:
+		if state == swarm.UpdateStateUpdating || state == swarm.UpdateStateRollbackStarted {
+			return opts, fmt.Errorf("cannot force update service %v, an update is in progress (%v)", svc.Spec.Name, state)
+		}
+		opts.TaskTemplate.ForceUpdate++
+	case model.ActionRollback:
+		if svc.PreviousSpec == nil {
+			return opts, fmt.Errorf("cannot roll back service %v, it has no previous spec", svc.Spec.Name)
+		}
+		if state == swarm.UpdateStateRollbackStarted {
+			return opts, fmt.Errorf("cannot roll back service %v, a rollback is in progress", svc.Spec.Name)
+		}
+		opts.Rollback = "previous"
+	case model.ActionPause:
+		return opts, errPauseUnsupported
+	case model.ActionResume:
+		// Updating a paused service with its own spec makes the swarm carry on with the update
+		if state != swarm.UpdateStatePaused && state != swarm.UpdateStateRollbackPaused {
+			return opts, fmt.Errorf("cannot resume service %v, its update is not paused (%v)", svc.Spec.Name, state)
+		}
+	default:
+		return opts, fmt.Errorf("unknown action %v", action)
+	}
+	return opts, nil
+}
+
+// watchJob polls the service and its tasks, pushing job progress events until the update settles.
+func (server *EventServer) watchJob(job model.DJob) {
+	deadline := job.Started.Add(jobTimeout)
+	for {
+		time.Sleep(jobPollInterval)
+
+		svc, err := server.Client.InspectService(job.ServiceId)
+		if err != nil {
+			server.finishJob(job, "failed", err.Error())
+			return
+		}
+		tasks, err := server.Client.ListTasks(docker.ListTasksOptions{Filters: map[string][]string{"service": {job.ServiceId}}})
+		if err != nil {
+			server.finishJob(job, "failed", err.Error())
+			return
+		}
+
+		job.Tasks = countTaskStates(tasks)
+		job.UpdateState = string(updateState(svc))
+		if svc.UpdateStatus != nil {
+			job.Message = svc.UpdateStatus.Message
+		}
+
+		switch {
+		case job.Action == model.ActionResume:
+			// Resuming only has to be accepted by the swarm.
+			server.finishJob(job, "completed", job.Message)
+			return
+		case isFinalUpdateState(updateState(svc)) && converged(tasks):
+			server.finishJob(job, "completed", job.Message)
+			return
+		case updateState(svc) == swarm.UpdateStatePaused || updateState(svc) == swarm.UpdateStateRollbackPaused:
+			server.finishJob(job, "failed", job.Message)
+			return
+		case time.Now().After(deadline):
+			server.finishJob(job, "failed", "timed out waiting for the update to complete")
+			return
+		}
+
+		server.jobs.put(job)
+		server.AddEventToSendQueue(marshal(&model.DJobEvent{Action: model.ActionUpdate, Type: "job", Djob: job}))
+	}
+}
+
+func (server *EventServer) finishJob(job model.DJob, state string, message string) {
+	now := time.Now()
+	job.State = state
+	job.Message = message
+	job.Finished = &now
+	server.jobs.put(job)
+	server.AddEventToSendQueue(marshal(&model.DJobEvent{Action: model.ActionStop, Type: "job", Djob: job}))
+	logrus.Infof("Job %v finished as %v", job.Id, state)
+}
+
+func updateState(svc *swarm.Service) swarm.UpdateState {
+	if svc.UpdateStatus == nil {
+		return ""
+	}
+	return svc.UpdateStatus.State
+}
+
+// isFinalUpdateState reports whether an update has settled. Without any state the swarm has not started it yet.
+func isFinalUpdateState(state swarm.UpdateState) bool {
+	return state == swarm.UpdateStateCompleted || state == swarm.UpdateStateRollbackCompleted
+}
+
+// converged reports whether every task that should be running also is.
+func converged(tasks []swarm.Task) bool {
+	for _, task := range tasks {
+		if task.DesiredState == swarm.TaskStateRunning && task.Status.State != swarm.TaskStateRunning {
+			return false
+		}
+	}
+	return true
+}
+
+func countTaskStates(tasks []swarm.Task) map[string]int {
+	counts := make(map[string]int)
+	for _, task := range tasks {
+		if task.DesiredState != swarm.TaskStateRunning && task.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+		counts[string(task.Status.State)]++
+	}
+	return counts
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+// newId returns a random id, such as of a job.
+func newId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// pathParams returns the slash-separated segments following prefix in path.
+func pathParams(prefix string, path string) []string {
+	if !strings.HasPrefix(path, prefix) {
+		return nil
+	}
+	rest := strings.Trim(path[len(prefix):], "/")
+	if rest == "" {
+		return nil
+	}
+	return strings.Split(rest, "/")
+}
+
+func marshal(intf interface{}) []byte {
+	data, _ := json.Marshal(intf)
+	return data
+}
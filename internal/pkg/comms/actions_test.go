@@ -0,0 +1,104 @@
+package comms
+
+import (
+	"github.com/docker/docker/api/types/swarm"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestForceUpdateRejectedWhileUpdating(t *testing.T) {
+	svc := buildService(swarm.UpdateStateUpdating)
+	Convey("Assert", t, func() {
+		_, err := updateOptionsFor(ActionForceUpdate, svc)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestForceUpdateIncrementsForceUpdate(t *testing.T) {
+	svc := buildService(swarm.UpdateStateCompleted)
+	Convey("Assert", t, func() {
+		opts, err := updateOptionsFor(ActionForceUpdate, svc)
+		So(err, ShouldBeNil)
+		So(opts.TaskTemplate.ForceUpdate, ShouldEqual, 1)
+		So(opts.Version, ShouldEqual, 7)
+	})
+}
+
+func TestRollbackRequiresPreviousSpec(t *testing.T) {
+	svc := buildService("")
+	Convey("Assert", t, func() {
+		_, err := updateOptionsFor(ActionRollback, svc)
+		So(err, ShouldNotBeNil)
+
+		svc.PreviousSpec = &swarm.ServiceSpec{}
+		opts, err := updateOptionsFor(ActionRollback, svc)
+		So(err, ShouldBeNil)
+		So(opts.Rollback, ShouldEqual, "previous")
+	})
+}
+
+func TestPauseDeclined(t *testing.T) {
+	svc := buildService(swarm.UpdateStateUpdating)
+	Convey("Assert", t, func() {
+		_, err := updateOptionsFor(ActionPause, svc)
+		So(err, ShouldEqual, errPauseUnsupported)
+	})
+}
+
+func TestResumeKeepsSpecOfPausedUpdate(t *testing.T) {
+	svc := buildService(swarm.UpdateStatePaused)
+	svc.Spec.UpdateConfig = &swarm.UpdateConfig{Delay: time.Second * 10}
+	Convey("Assert", t, func() {
+		opts, err := updateOptionsFor(ActionResume, svc)
+		So(err, ShouldBeNil)
+		So(opts.ServiceSpec, ShouldResemble, svc.Spec)
+		So(opts.Version, ShouldEqual, 7)
+	})
+}
+
+func TestRollbackAllowedWhilePaused(t *testing.T) {
+	svc := buildService(swarm.UpdateStatePaused)
+	svc.PreviousSpec = &swarm.ServiceSpec{}
+	Convey("Assert", t, func() {
+		opts, err := updateOptionsFor(ActionRollback, svc)
+		So(err, ShouldBeNil)
+		So(opts.Rollback, ShouldEqual, "previous")
+	})
+}
+
+func TestUpdateNotFinalBeforeItStarts(t *testing.T) {
+	Convey("Assert", t, func() {
+		So(isFinalUpdateState(""), ShouldBeFalse)
+		So(isFinalUpdateState(swarm.UpdateStateUpdating), ShouldBeFalse)
+		So(isFinalUpdateState(swarm.UpdateStateCompleted), ShouldBeTrue)
+		So(isFinalUpdateState(swarm.UpdateStateRollbackCompleted), ShouldBeTrue)
+	})
+}
+
+func TestResumeRejectedWhenNotPaused(t *testing.T) {
+	svc := buildService(swarm.UpdateStateCompleted)
+	Convey("Assert", t, func() {
+		_, err := updateOptionsFor(ActionResume, svc)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPathParams(t *testing.T) {
+	Convey("Assert", t, func() {
+		So(pathParams("/api/services/", "/api/services/abc/rollback"), ShouldResemble, []string{"abc", "rollback"})
+		So(pathParams("/api/services/", "/api/services/"), ShouldBeNil)
+		So(pathParams("/api/jobs/", "/api/services/abc"), ShouldBeNil)
+	})
+}
+
+func buildService(state swarm.UpdateState) *swarm.Service {
+	svc := &swarm.Service{ID: "service-1"}
+	svc.Version.Index = 7
+	svc.Spec.Name = "service-1-name"
+	if state != "" {
+		svc.UpdateStatus = &swarm.UpdateStatus{State: state}
+	}
+	return svc
+}
@@ -0,0 +1,26 @@
+package comms
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authenticated wraps handlers that modify the swarm or stream the output of what runs in it, requiring
+// "Authorization: Bearer <ApiToken>".
+// When no token has been configured, such handlers are disabled altogether.
+func (server *EventServer) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if server.ApiToken == "" {
+			http.Error(w, "Forbidden, no API token configured", 403)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(server.ApiToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", 401)
+			return
+		}
+		handler(w, r)
+	}
+}
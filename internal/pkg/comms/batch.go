@@ -0,0 +1,71 @@
+package comms
+
+import (
+	"encoding/json"
+	"github.com/eriklupander/dvizz/internal/pkg/history"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"time"
+)
+
+// batchWindow is how long events are collected after the first one before they are sent. The events of one poll
+// cycle are published in a burst, so they end up in the same batch.
+const batchWindow = time.Millisecond * 100
+
+// nextBatch waits for an event and collects those following it within the batch window.
+func (server *EventServer) nextBatch() [][]byte {
+	batch := [][]byte{<-server.eventQueue}
+	window := time.After(batchWindow)
+	for {
+		select {
+		case data := <-server.eventQueue:
+			batch = append(batch, data)
+		case <-window:
+			return batch
+		}
+	}
+}
+
+// coalesce drops updates of an entity superseded by a later update of the same entity in the batch. Other events,
+// such as starts and stops, are kept, and no update is dropped in favour of one published after them.
+func coalesce(batch [][]byte) [][]byte {
+	superseded := make(map[string]bool)
+	keep := make([]bool, len(batch))
+	kept := 0
+	for i := len(batch) - 1; i >= 0; i-- {
+		var event model.DHistoryEvent
+		if !history.Describe(batch[i], &event) {
+			keep[i] = true
+			kept++
+			continue
+		}
+		key := event.Type + "/" + event.Entity
+		if event.Action != "update" {
+			superseded[key] = false
+			keep[i] = true
+			kept++
+			continue
+		}
+		if !superseded[key] {
+			superseded[key] = true
+			keep[i] = true
+			kept++
+		}
+	}
+	result := make([][]byte, 0, kept)
+	for i, data := range batch {
+		if keep[i] {
+			result = append(result, data)
+		}
+	}
+	return result
+}
+
+// batchOf wraps events as one batch event.
+func batchOf(events [][]byte) []byte {
+	batch := model.DBatchEvent{Action: model.ActionBatch, Type: "batch", Events: make([]json.RawMessage, 0, len(events))}
+	for _, data := range events {
+		batch.Events = append(batch.Events, data)
+	}
+	data, _ := json.Marshal(&batch)
+	return data
+}
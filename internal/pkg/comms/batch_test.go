@@ -0,0 +1,75 @@
+package comms
+
+import (
+	"encoding/json"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCoalesce(t *testing.T) {
+	Convey("Given a batch with repeated updates of a task", t, func() {
+		batch := [][]byte{
+			taskEvent("start", "t1", "starting"),
+			taskEvent("update", "t1", "preparing"),
+			taskEvent("update", "t2", "running"),
+			taskEvent("update", "t1", "running"),
+		}
+		Convey("When coalesced", func() {
+			result := coalesce(batch)
+			Convey("Then only the last update of the task is kept, in its place", func() {
+				So(len(result), ShouldEqual, 3)
+				So(string(result[0]), ShouldEqual, string(batch[0]))
+				So(string(result[1]), ShouldEqual, string(batch[2]))
+				So(string(result[2]), ShouldEqual, string(batch[3]))
+			})
+		})
+	})
+
+	Convey("Given updates of a task stopped and started again", t, func() {
+		batch := [][]byte{
+			taskEvent("update", "t1", "running"),
+			taskEvent("stop", "t1", "running"),
+			taskEvent("start", "t1", "starting"),
+			taskEvent("update", "t1", "running"),
+		}
+		Convey("When coalesced", func() {
+			result := coalesce(batch)
+			Convey("Then no update is dropped for one after a stop or start", func() {
+				So(len(result), ShouldEqual, 4)
+			})
+		})
+	})
+
+	Convey("Given updates of a task and a service with the same id", t, func() {
+		service, _ := json.Marshal(&DServiceEvent{Action: "update", Type: "service", DService: DService{Id: "x"}})
+		batch := [][]byte{taskEvent("update", "x", "running"), service}
+		Convey("When coalesced", func() {
+			result := coalesce(batch)
+			Convey("Then both are kept", func() {
+				So(len(result), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestBatchOf(t *testing.T) {
+	Convey("Given two events", t, func() {
+		events := [][]byte{taskEvent("start", "t1", "starting"), taskEvent("stop", "t2", "running")}
+		Convey("When batched", func() {
+			var batch DBatchEvent
+			err := json.Unmarshal(batchOf(events), &batch)
+			Convey("Then they are sent as one batch event in order", func() {
+				So(err, ShouldBeNil)
+				So(batch.Type, ShouldEqual, "batch")
+				So(len(batch.Events), ShouldEqual, 2)
+				So(string(batch.Events[1]), ShouldEqual, string(events[1]))
+			})
+		})
+	})
+}
+
+func taskEvent(action Action, id string, status string) []byte {
+	data, _ := json.Marshal(&DEvent{Action: action, Type: "task", Dtask: DTask{Id: id, Status: status}})
+	return data
+}
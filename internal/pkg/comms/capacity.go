@@ -0,0 +1,17 @@
+package comms
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// getCapacity handles GET /api/capacity, optionally with ?service=<id> to see which nodes fit another replica.
+func (server *EventServer) getCapacity(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	report := server.Model.Capacity(r.URL.Query().Get("service"))
+	data, _ := json.Marshal(&report)
+	writeResponse(w, data)
+}
@@ -0,0 +1,31 @@
+package comms
+
+import (
+	"encoding/json"
+	"github.com/eriklupander/dvizz/internal/pkg/comms/mock_comms"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetCapacity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	fits := true
+	mockModel := mock_comms.NewMockModelProvider(ctrl)
+	mockModel.EXPECT().Capacity("s1").Return([]DNodeCapacity{{NodeId: "n1", Name: "worker-1", Fits: &fits}}).Times(1)
+	server := &EventServer{Model: mockModel}
+
+	w := httptest.NewRecorder()
+	server.getCapacity(w, httptest.NewRequest("GET", "/api/capacity?service=s1", nil))
+	report := make([]DNodeCapacity, 0)
+
+	Convey("Assert", t, func() {
+		So(w.Code, ShouldEqual, 200)
+		So(json.Unmarshal(w.Body.Bytes(), &report), ShouldBeNil)
+		So(len(report), ShouldEqual, 1)
+		So(*report[0].Fits, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,168 @@
+package comms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/eriklupander/dvizz/internal/pkg/schema"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack"
+	"reflect"
+	"time"
+)
+
+// The subprotocols a subscriber may ask for on /start. Without any, events are sent as JSON.
+const (
+	jsonProtocol    = "dvizz.json"
+	msgpackProtocol = "dvizz.msgpack"
+)
+
+// writeWait is how long a subscriber may take to receive a message before it is considered gone.
+const writeWait = 10 * time.Second
+
+// message is a message encoded as negotiated for the connection of a subscriber, ready to be written.
+type message struct {
+	kind int
+	data []byte
+}
+
+func (m message) write(conn *websocket.Conn) error {
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return conn.WriteMessage(m.kind, m.data)
+}
+
+// write sends an event to a subscriber encoded as negotiated for the connection, as JSON text messages by default
+// or as MessagePack binary messages.
+func write(conn *websocket.Conn, data []byte) error {
+	m, err := encodings(nil).encode(conn, data)
+	if err != nil {
+		return err
+	}
+	return m.write(conn)
+}
+
+// encodings keeps the MessagePack encoding of the messages of one broadcast by their JSON, as most subscribers get
+// the same messages.
+type encodings map[string][]byte
+
+// encode encodes an event as negotiated for the connection, reusing the encoding made for another subscriber.
+func (e encodings) encode(conn *websocket.Conn, data []byte) (message, error) {
+	if conn.Subprotocol() != msgpackProtocol {
+		return message{kind: websocket.TextMessage, data: data}, nil
+	}
+	encoded, err := e.msgpack(data)
+	if err != nil {
+		return message{}, err
+	}
+	return message{kind: websocket.BinaryMessage, data: encoded}, nil
+}
+
+// msgpack returns the MessagePack encoding of a message, encoding it only the first time.
+func (e encodings) msgpack(data []byte) ([]byte, error) {
+	if encoded, ok := e[string(data)]; ok {
+		return encoded, nil
+	}
+	encoded, err := toMsgpack(data)
+	if err == nil && e != nil {
+		e[string(data)] = encoded
+	}
+	return encoded, err
+}
+
+// read receives a message from a subscriber encoded as negotiated for the connection.
+func read(conn *websocket.Conn, v interface{}) error {
+	if conn.Subprotocol() != msgpackProtocol {
+		return conn.ReadJSON(v)
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return msgpack.NewDecoder(bytes.NewReader(data)).UseJSONTag(true).Decode(v)
+}
+
+// toMsgpack encodes a message as MessagePack from the model types it is made of rather than from its JSON, each
+// struct as an array of its fields in the order declared, so that no field names are sent.
+func toMsgpack(data []byte) ([]byte, error) {
+	value, err := typed(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = msgpack.NewEncoder(&buf).StructAsArray(true).UseCompactEncoding(true).Encode(value)
+	return buf.Bytes(), err
+}
+
+// packedEnvelope is a model.DEnvelope as sent with MessagePack, its payload being of the model type it carries.
+type packedEnvelope struct {
+	Version   int
+	Stream    string
+	Seq       uint64
+	Timestamp time.Time
+	Type      string
+	Action    model.Action
+	Payload   interface{}
+}
+
+// payloadTypes are the payload types of the messages, by message type.
+var payloadTypes = make(map[string]reflect.Type)
+
+func init() {
+	for _, m := range schema.Messages {
+		if m.Payload != nil {
+			payloadTypes[m.Type] = reflect.TypeOf(m.Payload)
+		}
+	}
+}
+
+// typed decodes a message into the model types it is made of. Apart from the messages in envelopes, only log lines
+// are sent to subscribers that may ask for MessagePack.
+func typed(data []byte) (interface{}, error) {
+	var envelope model.DEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Version == 0 {
+		var line model.DLogLine
+		err := json.Unmarshal(data, &line)
+		return line, err
+	}
+	packed := packedEnvelope{
+		Version:   envelope.Version,
+		Stream:    envelope.Stream,
+		Seq:       envelope.Seq,
+		Timestamp: envelope.Timestamp,
+		Type:      envelope.Type,
+		Action:    envelope.Action,
+	}
+	if len(envelope.Payload) == 0 {
+		return packed, nil
+	}
+	if envelope.Type == "batch" {
+		var events []json.RawMessage
+		if err := json.Unmarshal(envelope.Payload, &events); err != nil {
+			return nil, err
+		}
+		payload := make([]interface{}, 0, len(events))
+		for _, event := range events {
+			value, err := typed(event)
+			if err != nil {
+				return nil, err
+			}
+			payload = append(payload, value)
+		}
+		packed.Payload = payload
+		return packed, nil
+	}
+	t, ok := payloadTypes[envelope.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %v", envelope.Type)
+	}
+	payload := reflect.New(t)
+	if err := json.Unmarshal(envelope.Payload, payload.Interface()); err != nil {
+		return nil, err
+	}
+	packed.Payload = payload.Elem().Interface()
+	return packed, nil
+}
@@ -0,0 +1,193 @@
+package comms
+
+import (
+	. "github.com/eriklupander/dvizz/pkg/model"
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/vmihailenco/msgpack"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// taskEnvelope decodes the MessagePack encoding of an enveloped task event.
+type taskEnvelope struct {
+	Version   int
+	Stream    string
+	Seq       uint64
+	Timestamp time.Time
+	Type      string
+	Action    Action
+	Payload   DTask
+}
+
+func TestToMsgpack(t *testing.T) {
+	Convey("Given an enveloped event", t, func() {
+		code := 137
+		task := DTask{Id: "t1", Name: "web.1", Slot: 1, ExitCode: &code, Networks: []DNetwork{{Id: "n1", Addresses: []string{"10.0.1.5/24"}}}}
+		at := time.Date(2019, 6, 12, 3, 12, 0, 0, time.UTC)
+		data := marshal(Envelope(marshal(&DEvent{Action: ActionStart, Type: "task", Dtask: task}), 41, at))
+		Convey("When encoded as MessagePack", func() {
+			encoded, err := toMsgpack(data)
+			Convey("Then it decodes to the same typed event, without field names", func() {
+				So(err, ShouldBeNil)
+				var event taskEnvelope
+				So(msgpack.Unmarshal(encoded, &event), ShouldBeNil)
+				So(event.Seq, ShouldEqual, 41)
+				So(event.Timestamp.Equal(at), ShouldBeTrue)
+				So(event.Action, ShouldEqual, ActionStart)
+				So(event.Payload.Id, ShouldEqual, "t1")
+				So(*event.Payload.ExitCode, ShouldEqual, 137)
+				So(event.Payload.Networks, ShouldResemble, task.Networks)
+				So(string(encoded), ShouldNotContainSubstring, "exitCode")
+			})
+		})
+	})
+
+	Convey("Given a batch of enveloped events", t, func() {
+		at := time.Date(2019, 6, 12, 3, 12, 0, 0, time.UTC)
+		event := marshal(Envelope(marshal(&DEvent{Action: ActionStop, Type: "task", Dtask: DTask{Id: "t1"}}), 41, at))
+		Convey("Then each event is encoded with its payload type", func() {
+			encoded, err := toMsgpack(envelopeBatch([][]byte{event, event}, at))
+			So(err, ShouldBeNil)
+			var batch struct {
+				Version   int
+				Stream    string
+				Seq       uint64
+				Timestamp time.Time
+				Type      string
+				Action    Action
+				Payload   []taskEnvelope
+			}
+			So(msgpack.Unmarshal(encoded, &batch), ShouldBeNil)
+			So(batch.Payload, ShouldHaveLength, 2)
+			So(batch.Payload[1].Payload.Id, ShouldEqual, "t1")
+		})
+	})
+
+	Convey("Given invalid JSON", t, func() {
+		Convey("Then it is not encoded", func() {
+			_, err := toMsgpack([]byte(`{"action":`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+// TestMsgpackSize compares the sizes of a task event as sent. Measured: 812 bytes as JSON, 682 bytes as
+// MessagePack re-encoded from the JSON with its field names, 383 bytes as MessagePack encoded from the model types.
+func TestMsgpackSize(t *testing.T) {
+	code := 0
+	at := time.Date(2019, 6, 12, 3, 12, 0, 0, time.UTC)
+	task := DTask{
+		Id: "kq3j5n2l1x9wz8v7u6t5s4r01", Name: "web.1", Status: "running", DesiredState: "running", Message: "started",
+		ExitCode:    &code,
+		ContainerId: "9f8e7d6c5b4a39281706f5e4d3c2b1a09f8e7d6c5b4a39281706f5e4d3c2b1a0",
+		Slot:        1, ServiceId: "p9o8i7u6y5t4r3e2w1q0a9s8d", Stack: "shop", NodeId: "z1x2c3v4b5n6m7l8k9j0h1g2f",
+		Digest:       "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		CreatedAt:    at,
+		UpdatedAt:    at,
+		Networks:     []DNetwork{{Id: "n1o2p3q4r5s6t7u8v9w0x1y2z", Name: "shop_default", Addresses: []string{"10.0.1.5/24"}}},
+		Reservations: DResources{NanoCPUs: 250000000, MemoryBytes: 134217728},
+		Limits:       DResources{NanoCPUs: 500000000, MemoryBytes: 268435456},
+	}
+	server := &EventServer{}
+	server.init()
+	data := server.envelope(marshal(&DEvent{Action: ActionStart, Type: "task", Dtask: task}), at)
+
+	Convey("Given a task event", t, func() {
+		encoded, err := toMsgpack(data)
+		So(err, ShouldBeNil)
+		Convey("Then its MessagePack encoding is less than half the size of its JSON", func() {
+			So(len(encoded), ShouldBeLessThan, len(data)/2)
+		})
+	})
+}
+
+func TestEncodingsReused(t *testing.T) {
+	Convey("Given the encodings of a broadcast", t, func() {
+		encoded := make(encodings)
+		data := []byte(`{"action":"start","type":"task","dtask":{"id":"t1"}}`)
+		Convey("When a message is encoded for two subscribers", func() {
+			first, err := encoded.msgpack(data)
+			So(err, ShouldBeNil)
+			second, err := encoded.msgpack(data)
+			So(err, ShouldBeNil)
+			Convey("Then it is encoded once", func() {
+				So(len(encoded), ShouldEqual, 1)
+				So(&second[0], ShouldEqual, &first[0])
+			})
+		})
+	})
+}
+
+func TestReadMsgpackScrubRequest(t *testing.T) {
+	requests := make(chan scrubRequest, 1)
+	upgrader := websocket.Upgrader{Subprotocols: []string{msgpackProtocol}}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		request := scrubRequest{}
+		if err := read(conn, &request); err == nil {
+			requests <- request
+		}
+	}))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/start"
+
+	Convey("Given a subscriber scrubbing with MessagePack", t, func() {
+		dialer := websocket.Dialer{Subprotocols: []string{msgpackProtocol}}
+		conn, _, err := dialer.Dial(url, nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("When it asks for a time", func() {
+			data, err := msgpack.Marshal(map[string]string{"at": "1h"})
+			So(err, ShouldBeNil)
+			So(conn.WriteMessage(websocket.BinaryMessage, data), ShouldBeNil)
+
+			Convey("Then the time is read", func() {
+				So((<-requests).At, ShouldEqual, "1h")
+			})
+		})
+	})
+}
+
+func TestSubscriberNegotiatesMsgpack(t *testing.T) {
+	server := &EventServer{stackFilters: make(map[*websocket.Conn]string), batchSubscribers: make(map[*websocket.Conn]bool)}
+	server.init()
+	registered := make(chan bool, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.registerChannel(w, r)
+		registered <- true
+	}))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/start"
+
+	Convey("Given a subscriber asking for MessagePack and compression", t, func() {
+		dialer := websocket.Dialer{Subprotocols: []string{msgpackProtocol}, EnableCompression: true}
+		conn, _, err := dialer.Dial(url, nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(conn.Subprotocol(), ShouldEqual, msgpackProtocol)
+
+		Convey("When an event is broadcast", func() {
+			<-registered
+			server.broadcast([][]byte{[]byte(`{"action":"start","type":"task","dtask":{"id":"t1"}}`)})
+
+			Convey("Then it is received as a binary MessagePack message", func() {
+				messageType, data, err := conn.ReadMessage()
+				So(err, ShouldBeNil)
+				So(messageType, ShouldEqual, websocket.BinaryMessage)
+				var event taskEnvelope
+				So(msgpack.Unmarshal(data, &event), ShouldBeNil)
+				So(event.Type, ShouldEqual, "task")
+				So(event.Payload.Id, ShouldEqual, "t1")
+			})
+		})
+	})
+}
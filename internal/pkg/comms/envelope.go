@@ -0,0 +1,60 @@
+package comms
+
+import (
+	"encoding/json"
+	"github.com/eriklupander/dvizz/internal/pkg/schema"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// payloads are the fields of the events as published holding what the event is about.
+var payloads = []string{"dtask", "dservice", "dnode", "dnetwork", "dsecret", "dconfig", "dvolume", "dstack", "dedge", "djob", "stats"}
+
+// legacyPing is the ping sent to subscribers in compatibility mode.
+var legacyPing = []byte(`{"msg":"PING"}`)
+
+// envelope wraps an event as published in the versioned envelope, numbering it.
+func (server *EventServer) envelope(data []byte, at time.Time) []byte {
+	event := Envelope(data, atomic.AddUint64(&server.seq, 1), at)
+	event.Stream = server.stream
+	return marshal(&event)
+}
+
+// Envelope wraps an event as published in the versioned envelope sent to subscribers.
+func Envelope(data []byte, seq uint64, at time.Time) model.DEnvelope {
+	fields := make(map[string]json.RawMessage)
+	json.Unmarshal(data, &fields)
+	event := model.DEnvelope{Version: model.EnvelopeVersion, Seq: seq, Timestamp: at}
+	json.Unmarshal(fields["type"], &event.Type)
+	json.Unmarshal(fields["action"], &event.Action)
+	for _, payload := range payloads {
+		if raw, ok := fields[payload]; ok {
+			event.Payload = raw
+			break
+		}
+	}
+	return event
+}
+
+// envelopeBatch wraps enveloped events as one batch.
+func envelopeBatch(events [][]byte, at time.Time) []byte {
+	batch := make([]json.RawMessage, 0, len(events))
+	for _, data := range events {
+		batch = append(batch, data)
+	}
+	return marshal(&model.DEnvelope{Version: model.EnvelopeVersion, Timestamp: at, Type: "batch", Action: model.ActionBatch, Payload: marshal(&batch)})
+}
+
+// ping tells a subscriber the connection is alive.
+func ping(at time.Time) []byte {
+	return marshal(&model.DEnvelope{Version: model.EnvelopeVersion, Timestamp: at, Type: "ping", Action: model.ActionPing})
+}
+
+// getSchema handles GET /api/schema.
+func (server *EventServer) getSchema(w http.ResponseWriter, r *http.Request) {
+	document := schema.Document()
+	data, _ := json.Marshal(&document)
+	writeResponse(w, data)
+}
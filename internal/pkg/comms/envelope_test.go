@@ -0,0 +1,89 @@
+package comms
+
+import (
+	"encoding/json"
+	"github.com/eriklupander/dvizz/internal/pkg/schema"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/xeipuuv/gojsonschema"
+	"testing"
+	"time"
+)
+
+func TestEnvelope(t *testing.T) {
+	server := &EventServer{}
+	at := time.Date(2019, 6, 12, 3, 12, 0, 0, time.UTC)
+
+	Convey("Given a task state update as published", t, func() {
+		data := marshal(&DTaskStateUpdate{Action: ActionUpdate, Type: "task", Id: "t1", State: "running", Dtask: DTask{Id: "t1", Status: "running"}})
+		Convey("When enveloped twice", func() {
+			var first, second DEnvelope
+			json.Unmarshal(server.envelope(data, at), &first)
+			json.Unmarshal(server.envelope(data, at), &second)
+			Convey("Then the task is the payload and the events are numbered", func() {
+				So(first.Version, ShouldEqual, EnvelopeVersion)
+				So(first.Type, ShouldEqual, "task")
+				So(first.Action, ShouldEqual, ActionUpdate)
+				So(first.Timestamp, ShouldEqual, at)
+				So(second.Seq, ShouldEqual, first.Seq+1)
+				var task DTask
+				So(json.Unmarshal(first.Payload, &task), ShouldBeNil)
+				So(task.Status, ShouldEqual, "running")
+			})
+		})
+	})
+}
+
+func TestEnvelopesValidateAgainstSchema(t *testing.T) {
+	server := &EventServer{}
+	now := time.Now()
+	document := schema.Document()
+	loaded, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(document))
+	if err != nil {
+		t.Fatalf("schema does not load: %v", err)
+	}
+
+	Convey("Given events of every kind", t, func() {
+		finished := now
+		events := [][]byte{
+			marshal(&DNodeEvent{Action: ActionStart, Type: "node", Dnode: DNode{Id: "n1", Labels: map[string]string{"zone": "a"}}}),
+			marshal(&DServiceEvent{Action: ActionUpdate, Type: "service", DService: DService{Id: "s1", Replicas: 2}}),
+			marshal(&DEvent{Action: ActionPending, Type: "task", Dtask: DTask{Id: "t1", Err: "no suitable node"}}),
+			marshal(&DTaskStateUpdate{Action: ActionUpdate, Type: "task", Id: "t1", Dtask: DTask{Id: "t1"}}),
+			marshal(&DNetworkEvent{Action: ActionStop, Type: "network", Dnetwork: DSwarmNetwork{Id: "net1"}}),
+			marshal(&DSecretEvent{Action: ActionUnused, Type: "secret", Dsecret: DSecret{Id: "sec1"}}),
+			marshal(&DConfigEvent{Action: ActionStart, Type: "config", Dconfig: DConfig{Id: "cfg1"}}),
+			marshal(&DVolumeEvent{Action: ActionStart, Type: "volume", Dvolume: DVolume{Id: "v1"}}),
+			marshal(&DStackEvent{Action: ActionUpdate, Type: "stack", Dstack: DStack{Name: "web"}}),
+			marshal(&DEdgeEvent{Action: ActionStart, Type: "edge", Dedge: DEdge{Id: "s1-s2"}}),
+			marshal(&DJobEvent{Action: ActionStop, Type: "job", Djob: DJob{Id: "j1", Finished: &finished}}),
+			marshal(&DStatsEvent{Action: ActionUpdate, Type: "stats", Stats: map[string]DTaskStats{"t1": {}}}),
+		}
+		Convey("When enveloped", func() {
+			enveloped := make([][]byte, 0)
+			for _, data := range events {
+				enveloped = append(enveloped, server.envelope(data, now))
+			}
+			messages := append(enveloped, ping(now), envelopeBatch(enveloped[:2], now))
+			messages = append(messages,
+				marshal(&DEnvelope{Version: EnvelopeVersion, Timestamp: now, Type: "state", Action: ActionUpdate, Payload: marshal(&DSnapshot{Nodes: []DNode{{Id: "n1"}}})}),
+				marshal(&DEnvelope{Version: EnvelopeVersion, Timestamp: now, Type: "error", Action: ActionError, Payload: marshal(&DError{Message: "invalid time"})}))
+			Convey("Then every message is valid", func() {
+				for _, message := range messages {
+					result, err := loaded.Validate(gojsonschema.NewBytesLoader(message))
+					So(err, ShouldBeNil)
+					So(result.Errors(), ShouldBeEmpty)
+				}
+			})
+		})
+	})
+
+	Convey("Given an event with an action its type does not have", t, func() {
+		data := server.envelope(marshal(&DNodeEvent{Action: ActionPending, Type: "node", Dnode: DNode{Id: "n1"}}), now)
+		Convey("Then it is not valid", func() {
+			result, err := loaded.Validate(gojsonschema.NewBytesLoader(data))
+			So(err, ShouldBeNil)
+			So(result.Valid(), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package comms
+
+import (
+	"bytes"
+	"github.com/eriklupander/dvizz/internal/pkg/export"
+	"net/http"
+	"strconv"
+)
+
+// getExport handles GET /api/export?format=dot|graphml|mermaid|cytoscape, optionally narrowed down to one stack by
+// &stack={name}.
+func (server *EventServer) getExport(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatDot
+	}
+	snapshot := server.Model.Snapshot()
+	if stack := r.URL.Query().Get("stack"); stack != "" {
+		snapshot = export.ForStack(snapshot, stack)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := export.Render(buf, format, snapshot); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
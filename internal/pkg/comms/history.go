@@ -0,0 +1,176 @@
+package comms
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/eriklupander/dvizz/internal/pkg/diff"
+	"github.com/eriklupander/dvizz/internal/pkg/history"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HistoryStore keeps the published events for later querying.
+type HistoryStore interface {
+	RecordBatch(batch [][]byte) error
+	Events(q history.Query) ([]model.DHistoryEvent, error)
+	StateAt(t time.Time) (model.DSnapshot, error)
+	Snapshots() ([]model.DSnapshotInfo, error)
+	Snapshot(id string) (model.DSnapshot, time.Time, error)
+	Close() error
+}
+
+// getHistory handles GET /api/history?from=&to=&entity=&service=&type=&action=&limit=, returning the matching events
+// the latest first. from and to accept the same as since of the log endpoints.
+func (server *EventServer) getHistory(w http.ResponseWriter, r *http.Request) {
+	if server.History == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	q, err := historyQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	events, err := server.History.Events(q)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	data, _ := json.Marshal(&events)
+	writeResponse(w, data)
+}
+
+// getState handles GET /api/state?at=, rebuilding the nodes, services, tasks and networks as they were at that time.
+func (server *EventServer) getState(w http.ResponseWriter, r *http.Request) {
+	if server.History == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	at, err := parseSince(r.URL.Query().Get("at"), time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid at %v", r.URL.Query().Get("at")), 400)
+		return
+	}
+	state, err := server.History.StateAt(at)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	data, _ := json.Marshal(&state)
+	writeResponse(w, data)
+}
+
+// getSnapshots handles GET /api/snapshots, listing the stored snapshots the oldest first.
+func (server *EventServer) getSnapshots(w http.ResponseWriter, r *http.Request) {
+	if server.History == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	snapshots, err := server.History.Snapshots()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	data, _ := json.Marshal(&snapshots)
+	writeResponse(w, data)
+}
+
+// getDiff handles GET /api/diff, comparing the state at ?from= with the state at ?to=, or stored snapshots by
+// ?fromSnapshot= and ?toSnapshot=. Without a to, the state is compared with the current one.
+func (server *EventServer) getDiff(w http.ResponseWriter, r *http.Request) {
+	if server.History == nil || server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	query := r.URL.Query()
+	now := time.Now()
+
+	from, fromTime, err := server.stateOf(query.Get("from"), query.Get("fromSnapshot"), now)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	var to model.DSnapshot
+	toTime := now
+	if query.Get("to") == "" && query.Get("toSnapshot") == "" {
+		to = server.Model.Snapshot()
+	} else if to, toTime, err = server.stateOf(query.Get("to"), query.Get("toSnapshot"), now); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	result := diff.Snapshots(from, fromTime, to, toTime)
+	data, _ := json.Marshal(&result)
+	writeResponse(w, data)
+}
+
+// stateOf returns a stored snapshot if an id is given, or else the state rebuilt at the given time.
+func (server *EventServer) stateOf(at string, snapshotId string, now time.Time) (model.DSnapshot, time.Time, error) {
+	if snapshotId != "" {
+		return server.History.Snapshot(snapshotId)
+	}
+	t, err := parseSince(at, now)
+	if err != nil {
+		return model.DSnapshot{}, t, fmt.Errorf("invalid time %v", at)
+	}
+	state, err := server.History.StateAt(t)
+	return state, t, err
+}
+
+// scrubRequest is sent by a scrubbing subscriber to ask for the state at a time.
+type scrubRequest struct {
+	At string `json:"at"`
+}
+
+// scrub serves a subscriber connected with /start?mode=scrub. Instead of live events, the subscriber gets the state
+// as of every {"at": ...} message it sends, until it disconnects. The state is the payload of an envelope stamped with
+// the time asked for, or an error if it cannot be rebuilt.
+func (server *EventServer) scrub(conn *websocket.Conn) {
+	defer conn.Close()
+	for {
+		request := scrubRequest{}
+		if err := read(conn, &request); err != nil {
+			logrus.Debugf("Scrubbing subscriber %v left: %v", conn.RemoteAddr().String(), err)
+			return
+		}
+		var state model.DSnapshot
+		at, err := parseSince(request.At, time.Now())
+		if err == nil {
+			state, err = server.History.StateAt(at)
+		}
+		reply := model.DEnvelope{Version: model.EnvelopeVersion, Timestamp: at, Type: "state", Action: model.ActionUpdate, Payload: marshal(&state)}
+		if err != nil {
+			reply = model.DEnvelope{Version: model.EnvelopeVersion, Timestamp: time.Now(), Type: "error", Action: model.ActionError, Payload: marshal(&model.DError{Message: err.Error()})}
+		}
+		if err := write(conn, marshal(&reply)); err != nil {
+			return
+		}
+	}
+}
+
+func historyQuery(query url.Values, now time.Time) (history.Query, error) {
+	q := history.Query{Entity: query.Get("entity"), Service: query.Get("service"), Type: query.Get("type"), Action: query.Get("action")}
+	var err error
+
+	if v := query.Get("from"); v != "" {
+		if q.From, err = parseSince(v, now); err != nil {
+			return q, fmt.Errorf("invalid from %v", v)
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if q.To, err = parseSince(v, now); err != nil {
+			return q, fmt.Errorf("invalid to %v", v)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("invalid limit %v", v)
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,84 @@
+package comms
+
+import (
+	"encoding/json"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryQuery(t *testing.T) {
+	now := time.Date(2019, 6, 12, 10, 0, 0, 0, time.UTC)
+	values, _ := url.ParseQuery("from=1h&to=2019-06-12T09:30:00Z&service=s1&type=task&action=start&limit=10")
+
+	q, err := historyQuery(values, now)
+
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(q.From, ShouldEqual, now.Add(-time.Hour))
+		So(q.To, ShouldEqual, time.Date(2019, 6, 12, 9, 30, 0, 0, time.UTC))
+		So(q.Service, ShouldEqual, "s1")
+		So(q.Type, ShouldEqual, "task")
+		So(q.Action, ShouldEqual, "start")
+		So(q.Limit, ShouldEqual, 10)
+	})
+}
+
+func TestHistoryQueryInvalidLimit(t *testing.T) {
+	values, _ := url.ParseQuery("limit=many")
+	_, err := historyQuery(values, time.Now())
+	Convey("Assert", t, func() {
+		So(err, ShouldNotBeNil)
+	})
+}
+
+// stateHistory rebuilds the same state at any time.
+type stateHistory struct {
+	HistoryStore
+	state DSnapshot
+}
+
+func (h stateHistory) StateAt(t time.Time) (DSnapshot, error) {
+	return h.state, nil
+}
+
+func TestScrubRepliesInEnvelopes(t *testing.T) {
+	server := &EventServer{History: stateHistory{state: DSnapshot{Nodes: []DNode{{Id: "n1"}}}}}
+	server.init()
+	httpServer := httptest.NewServer(http.HandlerFunc(server.registerChannel))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/start?mode=scrub"
+
+	Convey("Given a subscriber scrubbing the history", t, func() {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("When it asks for a time and then for an invalid one", func() {
+			So(conn.WriteJSON(map[string]string{"at": "2019-06-12T03:12:00Z"}), ShouldBeNil)
+			So(conn.WriteJSON(map[string]string{"at": "yesterday"}), ShouldBeNil)
+
+			Convey("Then it is sent the state and then an error, enveloped", func() {
+				var state, failure DEnvelope
+				So(conn.ReadJSON(&state), ShouldBeNil)
+				So(state.Version, ShouldEqual, EnvelopeVersion)
+				So(state.Type, ShouldEqual, "state")
+				So(state.Timestamp, ShouldEqual, time.Date(2019, 6, 12, 3, 12, 0, 0, time.UTC))
+				var snapshot DSnapshot
+				So(json.Unmarshal(state.Payload, &snapshot), ShouldBeNil)
+				So(snapshot.Nodes[0].Id, ShouldEqual, "n1")
+
+				So(conn.ReadJSON(&failure), ShouldBeNil)
+				So(failure.Type, ShouldEqual, "error")
+				So(failure.Action, ShouldEqual, ActionError)
+				So(string(failure.Payload), ShouldContainSubstring, "yesterday")
+			})
+		})
+	})
+}
@@ -0,0 +1,351 @@
+package comms
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/eriklupander/dvizz/pkg/model"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	detailNodeId    = "com.docker.swarm.node.id"
+	detailServiceId = "com.docker.swarm.service.id"
+	detailTaskId    = "com.docker.swarm.task.id"
+)
+
+// services dispatches /api/services/{id}/logs to the log streamer and everything else to the service actions, both
+// requiring the API token.
+func (server *EventServer) services(w http.ResponseWriter, r *http.Request) {
+	params := pathParams("/api/services/", r.URL.Path)
+	if len(params) == 2 && params[1] == "logs" {
+		server.authenticated(func(w http.ResponseWriter, r *http.Request) {
+			server.streamLogs(w, r, params[0], "")
+		})(w, r)
+		return
+	}
+	server.authenticated(server.serviceAction)(w, r)
+}
+
+// tasks handles /api/tasks/{id}/logs, requiring the API token.
+func (server *EventServer) tasks(w http.ResponseWriter, r *http.Request) {
+	params := pathParams("/api/tasks/", r.URL.Path)
+	if len(params) != 2 || params[1] != "logs" {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	task, err := server.Client.InspectTask(params[0])
+	if err != nil {
+		if _, ok := err.(*docker.NoSuchTask); ok {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	server.streamLogs(w, r, task.ServiceID, task.ID)
+}
+
+// streamLogs upgrades the request to a WebSocket and streams the logs of the service, or of a single one of its
+// tasks if taskId is set, as model.DLogLine messages until the logs end or the client disconnects.
+//
+// The Docker API has no task logs in go-dockerclient, so task logs are the service logs filtered by the task id
+// found in the log details.
+func (server *EventServer) streamLogs(w http.ResponseWriter, r *http.Request, serviceId string, taskId string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	opts, timestamps, err := logOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), 400)
+		return
+	}
+
+	c, err := server.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Errorf("upgrade: %v", err)
+		return
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Reading is how we learn that the client went away, which cancels the log request.
+	go func() {
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	lw := &logWriter{conn: c, taskId: taskId, timestamps: timestamps, tail: -1}
+	opts.Context = ctx
+	opts.Service = serviceId
+	opts.Details = true
+	opts.Timestamps = true
+
+	logrus.Infof("Streaming logs of service %v task %v to %v", serviceId, taskId, c.RemoteAddr().String())
+	if taskId != "" && opts.Tail != "all" {
+		err = server.taskLogs(opts, lw)
+	} else {
+		err = server.serviceLogs(opts, lw)
+	}
+	if err != nil && ctx.Err() == nil {
+		logrus.Warnf("problem streaming logs of service %v: %v", serviceId, err)
+		lw.writeClose(websocket.CloseInternalServerErr, err.Error())
+		return
+	}
+	lw.writeClose(websocket.CloseNormalClosure, "")
+}
+
+// taskLogs tails the lines of one task. Docker would tail the lines of the whole service, leaving few or none of
+// the task, so the logs are read in full and tailed here before any new line is followed.
+func (server *EventServer) taskLogs(opts docker.LogsServiceOptions, lw *logWriter) error {
+	lw.tail, _ = strconv.Atoi(opts.Tail)
+	follow := opts.Follow
+	started := time.Now()
+	opts.Tail = "all"
+	opts.Follow = false
+	if err := server.serviceLogs(opts, lw); err != nil {
+		return err
+	}
+	if err := lw.flushTail(); err != nil || !follow {
+		return err
+	}
+
+	// Following from the second of the last line read, skipping the lines already sent
+	opts.Follow = true
+	opts.Since = started.Unix()
+	if !lw.last.IsZero() {
+		opts.Since = lw.last.Unix()
+	}
+	return server.serviceLogs(opts, lw)
+}
+
+// serviceLogs streams the service logs through the log writer.
+func (server *EventServer) serviceLogs(opts docker.LogsServiceOptions, lw *logWriter) error {
+	stdout, stderr := lw.stream("stdout"), lw.stream("stderr")
+	opts.OutputStream = stdout
+	opts.ErrorStream = stderr
+	err := server.Client.GetServiceLogs(opts)
+	// The last line of a stream may have no newline
+	if err := stdout.flush(); err != nil {
+		return err
+	}
+	if err := stderr.flush(); err != nil {
+		return err
+	}
+	return err
+}
+
+// logOptions reads follow, tail, since, timestamps, stdout and stderr from the query.
+func logOptions(query url.Values) (docker.LogsServiceOptions, bool, error) {
+	opts := docker.LogsServiceOptions{Tail: "all", Stdout: true, Stderr: true}
+	timestamps := false
+	var err error
+
+	if v := query.Get("follow"); v != "" {
+		if opts.Follow, err = strconv.ParseBool(v); err != nil {
+			return opts, false, fmt.Errorf("invalid follow %v", v)
+		}
+	}
+	if v := query.Get("timestamps"); v != "" {
+		if timestamps, err = strconv.ParseBool(v); err != nil {
+			return opts, false, fmt.Errorf("invalid timestamps %v", v)
+		}
+	}
+	if v := query.Get("stdout"); v != "" {
+		if opts.Stdout, err = strconv.ParseBool(v); err != nil {
+			return opts, false, fmt.Errorf("invalid stdout %v", v)
+		}
+	}
+	if v := query.Get("stderr"); v != "" {
+		if opts.Stderr, err = strconv.ParseBool(v); err != nil {
+			return opts, false, fmt.Errorf("invalid stderr %v", v)
+		}
+	}
+	if v := query.Get("tail"); v != "" && v != "all" {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			return opts, false, fmt.Errorf("invalid tail %v", v)
+		}
+		opts.Tail = v
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := parseSince(v, time.Now())
+		if err != nil {
+			return opts, false, err
+		}
+		opts.Since = since.Unix()
+	}
+	return opts, timestamps, nil
+}
+
+// parseSince accepts unix seconds, an RFC3339 timestamp or a duration such as 10m relative to now.
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %v", v)
+}
+
+// logWriter turns the demultiplexed log streams into DLogLine messages on a WebSocket connection.
+type logWriter struct {
+	sync.Mutex
+	conn       *websocket.Conn
+	taskId     string
+	timestamps bool
+	// How many lines to keep until flushTail, -1 when lines are sent as they come
+	tail int
+	kept []model.DLogLine
+	// Time of the last line of the task read, and of the last one read before following, up to which lines are
+	// not sent again
+	last time.Time
+	sent time.Time
+}
+
+func (lw *logWriter) stream(name string) *lineWriter {
+	return &lineWriter{lw: lw, name: name}
+}
+
+func (lw *logWriter) writeLine(stream string, raw string) error {
+	line := parseLogLine(stream, raw)
+	if lw.taskId != "" && line.TaskId != lw.taskId {
+		return nil
+	}
+	lw.Lock()
+	defer lw.Unlock()
+	if line.Timestamp != nil {
+		if !lw.sent.IsZero() && !line.Timestamp.After(lw.sent) {
+			return nil
+		}
+		lw.last = *line.Timestamp
+	}
+	if lw.tail >= 0 {
+		lw.kept = append(lw.kept, line)
+		if len(lw.kept) > lw.tail {
+			lw.kept = lw.kept[1:]
+		}
+		return nil
+	}
+	return lw.send(line)
+}
+
+// flushTail sends the lines kept, sending those that follow as they come.
+func (lw *logWriter) flushTail() error {
+	lw.Lock()
+	defer lw.Unlock()
+	kept := lw.kept
+	lw.kept = nil
+	lw.tail = -1
+	lw.sent = lw.last
+	for _, line := range kept {
+		if err := lw.send(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send writes a line. The lock must be held.
+func (lw *logWriter) send(line model.DLogLine) error {
+	if !lw.timestamps {
+		line.Timestamp = nil
+	}
+	return write(lw.conn, marshal(&line))
+}
+
+func (lw *logWriter) writeClose(code int, text string) {
+	lw.Lock()
+	defer lw.Unlock()
+	lw.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+}
+
+// lineWriter buffers one output stream, passing on complete lines only.
+type lineWriter struct {
+	lw   *logWriter
+	name string
+	buf  []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(w.buf[:i])
+		w.buf = w.buf[i+1:]
+		if err := w.lw.writeLine(w.name, line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// flush passes on what is left of the stream once it has ended.
+func (w *lineWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := string(w.buf)
+	w.buf = nil
+	return w.lw.writeLine(w.name, line)
+}
+
+// parseLogLine splits a line requested with both timestamps and details, "<timestamp> <details> <message>".
+func parseLogLine(stream string, raw string) model.DLogLine {
+	line := model.DLogLine{Type: "log", Stream: stream, Line: raw}
+
+	parts := strings.SplitN(raw, " ", 3)
+	if len(parts) < 2 {
+		return line
+	}
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return line
+	}
+	line.Timestamp = &ts
+	line.Line = strings.Join(parts[1:], " ")
+	if !strings.Contains(parts[1], detailTaskId+"=") {
+		return line
+	}
+
+	for _, pair := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v, _ := url.QueryUnescape(kv[1])
+		switch kv[0] {
+		case detailNodeId:
+			line.NodeId = v
+		case detailServiceId:
+			line.ServiceId = v
+		case detailTaskId:
+			line.TaskId = v
+		}
+	}
+	line.Line = ""
+	if len(parts) == 3 {
+		line.Line = parts[2]
+	}
+	return line
+}
@@ -0,0 +1,166 @@
+package comms
+
+import (
+	"github.com/eriklupander/dvizz/pkg/model"
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/vmihailenco/msgpack"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogLineWithDetails(t *testing.T) {
+	raw := "2019-06-12T10:00:00.123456789Z com.docker.swarm.node.id=n1,com.docker.swarm.service.id=s1,com.docker.swarm.task.id=t1 hello world"
+	line := parseLogLine("stderr", raw)
+	Convey("Assert", t, func() {
+		So(line.Stream, ShouldEqual, "stderr")
+		So(line.NodeId, ShouldEqual, "n1")
+		So(line.ServiceId, ShouldEqual, "s1")
+		So(line.TaskId, ShouldEqual, "t1")
+		So(line.Line, ShouldEqual, "hello world")
+		So(line.Timestamp, ShouldNotBeNil)
+		So(line.Timestamp.Nanosecond(), ShouldEqual, 123456789)
+	})
+}
+
+func TestParseLogLineWithoutPrefix(t *testing.T) {
+	line := parseLogLine("stdout", "just text")
+	Convey("Assert", t, func() {
+		So(line.Line, ShouldEqual, "just text")
+		So(line.Timestamp, ShouldBeNil)
+		So(line.TaskId, ShouldEqual, "")
+	})
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2019, 6, 12, 10, 0, 0, 0, time.UTC)
+	Convey("Assert", t, func() {
+		since, err := parseSince("10m", now)
+		So(err, ShouldBeNil)
+		So(since, ShouldEqual, now.Add(-time.Minute*10))
+
+		since, err = parseSince("1560333600", now)
+		So(err, ShouldBeNil)
+		So(since.Unix(), ShouldEqual, 1560333600)
+
+		since, err = parseSince("2019-06-12T09:00:00Z", now)
+		So(err, ShouldBeNil)
+		So(since, ShouldEqual, now.Add(-time.Hour))
+
+		_, err = parseSince("yesterday", now)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestLogOptions(t *testing.T) {
+	Convey("Assert", t, func() {
+		opts, timestamps, err := logOptions(url.Values{"follow": {"true"}, "tail": {"100"}, "timestamps": {"1"}, "stderr": {"false"}})
+		So(err, ShouldBeNil)
+		So(opts.Follow, ShouldBeTrue)
+		So(opts.Tail, ShouldEqual, "100")
+		So(opts.Stdout, ShouldBeTrue)
+		So(opts.Stderr, ShouldBeFalse)
+		So(timestamps, ShouldBeTrue)
+
+		_, _, err = logOptions(url.Values{"tail": {"-1"}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestTaskLogsTailedAfterFiltering(t *testing.T) {
+	lines := make(chan model.DLogLine, 10)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		c, _ := upgrader.Upgrade(w, r, nil)
+		defer c.Close()
+		lw := &logWriter{conn: c, taskId: "t1", tail: 2}
+		stdout := lw.stream("stdout")
+		stdout.Write([]byte("2019-06-12T10:00:01Z com.docker.swarm.task.id=t1 one\n" +
+			"2019-06-12T10:00:02Z com.docker.swarm.task.id=t1 two\n" +
+			"2019-06-12T10:00:03Z com.docker.swarm.task.id=t2 other\n" +
+			"2019-06-12T10:00:04Z com.docker.swarm.task.id=t1 three"))
+		stdout.flush()
+		lw.flushTail()
+		// Following from the second of the last line read repeats it
+		stdout.Write([]byte("2019-06-12T10:00:04Z com.docker.swarm.task.id=t1 three\n" +
+			"2019-06-12T10:00:05Z com.docker.swarm.task.id=t1 four\n"))
+		c.ReadMessage()
+	}))
+	defer httpServer.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		for {
+			line := model.DLogLine{}
+			if err := conn.ReadJSON(&line); err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	Convey("Assert", t, func() {
+		So((<-lines).Line, ShouldEqual, "two")
+		So((<-lines).Line, ShouldEqual, "three")
+		line := <-lines
+		So(line.Line, ShouldEqual, "four")
+		So(line.Timestamp, ShouldBeNil)
+	})
+}
+
+func TestLogsRequireToken(t *testing.T) {
+	server := &EventServer{ApiToken: "secret"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/services/", server.services)
+	mux.HandleFunc("/api/tasks/", server.authenticated(server.tasks))
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	Convey("Requests for logs without the API token are refused", t, func() {
+		for _, path := range []string{"/api/services/s1/logs", "/api/tasks/t1/logs"} {
+			resp, err := http.Get(httpServer.URL + path)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestLogLinesInMsgpack(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{Subprotocols: []string{msgpackProtocol}}
+		c, _ := upgrader.Upgrade(w, r, nil)
+		defer c.Close()
+		lw := &logWriter{conn: c, tail: -1}
+		stdout := lw.stream("stdout")
+		stdout.Write([]byte("2019-06-12T10:00:01Z com.docker.swarm.task.id=t1 one\n"))
+		c.ReadMessage()
+	}))
+	defer httpServer.Close()
+
+	Convey("Given a client asking for MessagePack", t, func() {
+		dialer := websocket.Dialer{Subprotocols: []string{msgpackProtocol}}
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("Then log lines are sent as MessagePack", func() {
+			messageType, data, err := conn.ReadMessage()
+			So(err, ShouldBeNil)
+			So(messageType, ShouldEqual, websocket.BinaryMessage)
+			line := model.DLogLine{}
+			So(msgpack.Unmarshal(data, &line), ShouldBeNil)
+			So(line.TaskId, ShouldEqual, "t1")
+			So(line.Line, ShouldEqual, "one")
+		})
+	})
+}
@@ -1,10 +1,11 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: internal/pkg/comms/server.go
+// Source: github.com/eriklupander/dvizz/internal/pkg/comms (interfaces: IEventServer,ModelProvider)
 
 // Package mock_comms is a generated GoMock package.
 package mock_comms
 
 import (
+	model "github.com/eriklupander/dvizz/pkg/model"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 )
@@ -33,15 +34,27 @@ func (m *MockIEventServer) EXPECT() *MockIEventServerMockRecorder {
 }
 
 // AddEventToSendQueue mocks base method
-func (m *MockIEventServer) AddEventToSendQueue(data []byte) {
+func (m *MockIEventServer) AddEventToSendQueue(arg0 []byte) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "AddEventToSendQueue", data)
+	m.ctrl.Call(m, "AddEventToSendQueue", arg0)
 }
 
 // AddEventToSendQueue indicates an expected call of AddEventToSendQueue
-func (mr *MockIEventServerMockRecorder) AddEventToSendQueue(data interface{}) *gomock.Call {
+func (mr *MockIEventServerMockRecorder) AddEventToSendQueue(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddEventToSendQueue", reflect.TypeOf((*MockIEventServer)(nil).AddEventToSendQueue), data)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddEventToSendQueue", reflect.TypeOf((*MockIEventServer)(nil).AddEventToSendQueue), arg0)
+}
+
+// Close mocks base method
+func (m *MockIEventServer) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close
+func (mr *MockIEventServerMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockIEventServer)(nil).Close))
 }
 
 // InitializeEventSystem mocks base method
@@ -56,14 +69,137 @@ func (mr *MockIEventServerMockRecorder) InitializeEventSystem() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitializeEventSystem", reflect.TypeOf((*MockIEventServer)(nil).InitializeEventSystem))
 }
 
-// Close mocks base method
-func (m *MockIEventServer) Close() {
+// MockModelProvider is a mock of ModelProvider interface
+type MockModelProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockModelProviderMockRecorder
+}
+
+// MockModelProviderMockRecorder is the mock recorder for MockModelProvider
+type MockModelProviderMockRecorder struct {
+	mock *MockModelProvider
+}
+
+// NewMockModelProvider creates a new mock instance
+func NewMockModelProvider(ctrl *gomock.Controller) *MockModelProvider {
+	mock := &MockModelProvider{ctrl: ctrl}
+	mock.recorder = &MockModelProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockModelProvider) EXPECT() *MockModelProviderMockRecorder {
+	return m.recorder
+}
+
+// Capacity mocks base method
+func (m *MockModelProvider) Capacity(arg0 string) []model.DNodeCapacity {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Close")
+	ret := m.ctrl.Call(m, "Capacity", arg0)
+	ret0, _ := ret[0].([]model.DNodeCapacity)
+	return ret0
 }
 
-// Close indicates an expected call of Close
-func (mr *MockIEventServerMockRecorder) Close() *gomock.Call {
+// Capacity indicates an expected call of Capacity
+func (mr *MockModelProviderMockRecorder) Capacity(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockIEventServer)(nil).Close))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capacity", reflect.TypeOf((*MockModelProvider)(nil).Capacity), arg0)
+}
+
+// Configs mocks base method
+func (m *MockModelProvider) Configs() []model.DConfig {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Configs")
+	ret0, _ := ret[0].([]model.DConfig)
+	return ret0
+}
+
+// Configs indicates an expected call of Configs
+func (mr *MockModelProviderMockRecorder) Configs() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Configs", reflect.TypeOf((*MockModelProvider)(nil).Configs))
+}
+
+// Graph mocks base method
+func (m *MockModelProvider) Graph(arg0 string) model.DServiceGraph {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Graph", arg0)
+	ret0, _ := ret[0].(model.DServiceGraph)
+	return ret0
+}
+
+// Graph indicates an expected call of Graph
+func (mr *MockModelProviderMockRecorder) Graph(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Graph", reflect.TypeOf((*MockModelProvider)(nil).Graph), arg0)
+}
+
+// Networks mocks base method
+func (m *MockModelProvider) Networks() []model.DSwarmNetwork {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Networks")
+	ret0, _ := ret[0].([]model.DSwarmNetwork)
+	return ret0
+}
+
+// Networks indicates an expected call of Networks
+func (mr *MockModelProviderMockRecorder) Networks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Networks", reflect.TypeOf((*MockModelProvider)(nil).Networks))
+}
+
+// Secrets mocks base method
+func (m *MockModelProvider) Secrets() []model.DSecret {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Secrets")
+	ret0, _ := ret[0].([]model.DSecret)
+	return ret0
+}
+
+// Secrets indicates an expected call of Secrets
+func (mr *MockModelProviderMockRecorder) Secrets() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Secrets", reflect.TypeOf((*MockModelProvider)(nil).Secrets))
+}
+
+// Snapshot mocks base method
+func (m *MockModelProvider) Snapshot() model.DSnapshot {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Snapshot")
+	ret0, _ := ret[0].(model.DSnapshot)
+	return ret0
+}
+
+// Snapshot indicates an expected call of Snapshot
+func (mr *MockModelProviderMockRecorder) Snapshot() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockModelProvider)(nil).Snapshot))
+}
+
+// Stacks mocks base method
+func (m *MockModelProvider) Stacks() []model.DStack {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stacks")
+	ret0, _ := ret[0].([]model.DStack)
+	return ret0
+}
+
+// Stacks indicates an expected call of Stacks
+func (mr *MockModelProviderMockRecorder) Stacks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stacks", reflect.TypeOf((*MockModelProvider)(nil).Stacks))
+}
+
+// Volumes mocks base method
+func (m *MockModelProvider) Volumes() []model.DVolume {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Volumes")
+	ret0, _ := ret[0].([]model.DVolume)
+	return ret0
+}
+
+// Volumes indicates an expected call of Volumes
+func (mr *MockModelProviderMockRecorder) Volumes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Volumes", reflect.TypeOf((*MockModelProvider)(nil).Volumes))
 }
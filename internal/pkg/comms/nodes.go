@@ -0,0 +1,178 @@
+package comms
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// NodeAvailabilityRequest is the body of POST /api/nodes/{id}/availability. Leave Confirmation empty to get a
+// plan of the tasks affected, then repeat the request with the confirmation of that plan to apply it.
+type NodeAvailabilityRequest struct {
+	Availability string `json:"availability"`
+	Confirmation string `json:"confirmation"`
+}
+
+// NodeLabelsRequest is the body of POST /api/nodes/{id}/labels.
+type NodeLabelsRequest struct {
+	Set    map[string]string `json:"set"`
+	Remove []string          `json:"remove"`
+}
+
+// NodeAvailabilityPlan describes what happens to the tasks of a node when its availability is changed.
+type NodeAvailabilityPlan struct {
+	NodeId       string        `json:"nodeId"`
+	Hostname     string        `json:"hostname"`
+	Current      string        `json:"current"`
+	Availability string        `json:"availability"`
+	Moving       []PlannedTask `json:"moving"`   // rescheduled onto other nodes
+	Stopping     []PlannedTask `json:"stopping"` // global service tasks that are not rescheduled
+	Confirmation string        `json:"confirmation"`
+	Applied      bool          `json:"applied"`
+}
+
+type PlannedTask struct {
+	Id          string `json:"id"`
+	ServiceId   string `json:"serviceId"`
+	ServiceName string `json:"serviceName"`
+	Slot        int    `json:"slot"`
+	State       string `json:"state"`
+}
+
+// nodeAction handles POST /api/nodes/{id}/availability and POST /api/nodes/{id}/labels.
+func (server *EventServer) nodeAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	params := pathParams("/api/nodes/", r.URL.Path)
+	if len(params) != 2 {
+		http.Error(w, "Not found", 404)
+		return
+	}
+
+	node, err := server.Client.InspectNode(params[0])
+	if err != nil {
+		if _, ok := err.(*docker.NoSuchNode); ok {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	switch params[1] {
+	case "availability":
+		server.changeAvailability(w, r, node)
+	case "labels":
+		server.changeLabels(w, r, node)
+	default:
+		http.Error(w, "Not found", 404)
+	}
+}
+
+func (server *EventServer) changeAvailability(w http.ResponseWriter, r *http.Request, node *swarm.Node) {
+	var req NodeAvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), 400)
+		return
+	}
+	availability := swarm.NodeAvailability(req.Availability)
+	if availability != swarm.NodeAvailabilityActive && availability != swarm.NodeAvailabilityPause && availability != swarm.NodeAvailabilityDrain {
+		http.Error(w, "Bad request: availability must be one of active, pause or drain", 400)
+		return
+	}
+
+	tasks, err := server.Client.ListTasks(docker.ListTasksOptions{Filters: map[string][]string{"node": {node.ID}, "desired-state": {"running"}}})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	services, err := server.Client.ListServices(docker.ListServicesOptions{})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	plan := planAvailability(node, availability, tasks, services)
+
+	if req.Confirmation != "" {
+		if req.Confirmation != plan.Confirmation {
+			http.Error(w, "Conflict: the node has changed since the plan was made, request a new plan", 409)
+			return
+		}
+		spec := node.Spec
+		spec.Availability = availability
+		if err := server.Client.UpdateNode(node.ID, docker.UpdateNodeOptions{NodeSpec: spec, Version: node.Version.Index}); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		plan.Applied = true
+		logrus.Infof("Changed availability of node %v from %v to %v, %v task(s) will move", node.Description.Hostname, plan.Current, availability, len(plan.Moving))
+	}
+
+	data, _ := json.Marshal(&plan)
+	writeResponse(w, data)
+}
+
+func (server *EventServer) changeLabels(w http.ResponseWriter, r *http.Request, node *swarm.Node) {
+	var req NodeLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), 400)
+		return
+	}
+
+	spec := node.Spec
+	spec.Labels = copyLabels(node.Spec.Labels)
+	for k, v := range req.Set {
+		spec.Labels[k] = v
+	}
+	for _, k := range req.Remove {
+		delete(spec.Labels, k)
+	}
+	if err := server.Client.UpdateNode(node.ID, docker.UpdateNodeOptions{NodeSpec: spec, Version: node.Version.Index}); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	logrus.Infof("Updated labels of node %v", node.Description.Hostname)
+
+	data, _ := json.Marshal(spec.Labels)
+	writeResponse(w, data)
+}
+
+// planAvailability works out which running tasks of the node are affected by the new availability. Only draining
+// moves tasks: replicated tasks are rescheduled elsewhere while global tasks are just stopped.
+func planAvailability(node *swarm.Node, availability swarm.NodeAvailability, tasks []swarm.Task, services []swarm.Service) NodeAvailabilityPlan {
+	plan := NodeAvailabilityPlan{
+		NodeId:       node.ID,
+		Hostname:     node.Description.Hostname,
+		Current:      string(node.Spec.Availability),
+		Availability: string(availability),
+		Moving:       make([]PlannedTask, 0),
+		Stopping:     make([]PlannedTask, 0),
+		Confirmation: fmt.Sprintf("%v-%v", node.Version.Index, availability),
+	}
+	if availability != swarm.NodeAvailabilityDrain || node.Spec.Availability == swarm.NodeAvailabilityDrain {
+		return plan
+	}
+
+	sm := make(map[string]swarm.Service)
+	for _, s := range services {
+		sm[s.ID] = s
+	}
+	for _, task := range tasks {
+		if task.NodeID != node.ID || task.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		s := sm[task.ServiceID]
+		pt := PlannedTask{Id: task.ID, ServiceId: task.ServiceID, ServiceName: s.Spec.Name, Slot: task.Slot, State: string(task.Status.State)}
+		if s.Spec.Mode.Global != nil {
+			plan.Stopping = append(plan.Stopping, pt)
+		} else {
+			plan.Moving = append(plan.Moving, pt)
+		}
+	}
+	return plan
+}
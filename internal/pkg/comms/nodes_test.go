@@ -0,0 +1,71 @@
+package comms
+
+import (
+	"github.com/docker/docker/api/types/swarm"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestPlanDrainMovesReplicatedAndStopsGlobal(t *testing.T) {
+	node := buildNode(swarm.NodeAvailabilityActive)
+	services := []swarm.Service{buildModeService("s1", false), buildModeService("s2", true)}
+	tasks := []swarm.Task{
+		buildPlacedTask("t1", "s1", "node-1"),
+		buildPlacedTask("t2", "s2", "node-1"),
+		buildPlacedTask("t3", "s1", "node-2"),
+	}
+
+	plan := planAvailability(node, swarm.NodeAvailabilityDrain, tasks, services)
+
+	Convey("Assert", t, func() {
+		So(len(plan.Moving), ShouldEqual, 1)
+		So(plan.Moving[0].Id, ShouldEqual, "t1")
+		So(plan.Moving[0].ServiceName, ShouldEqual, "s1-name")
+		So(len(plan.Stopping), ShouldEqual, 1)
+		So(plan.Stopping[0].Id, ShouldEqual, "t2")
+		So(plan.Confirmation, ShouldEqual, "3-drain")
+		So(plan.Applied, ShouldBeFalse)
+	})
+}
+
+func TestPlanPauseMovesNothing(t *testing.T) {
+	node := buildNode(swarm.NodeAvailabilityActive)
+	tasks := []swarm.Task{buildPlacedTask("t1", "s1", "node-1")}
+
+	plan := planAvailability(node, swarm.NodeAvailabilityPause, tasks, []swarm.Service{buildModeService("s1", false)})
+
+	Convey("Assert", t, func() {
+		So(len(plan.Moving), ShouldEqual, 0)
+		So(len(plan.Stopping), ShouldEqual, 0)
+		So(plan.Current, ShouldEqual, "active")
+	})
+}
+
+func buildNode(availability swarm.NodeAvailability) *swarm.Node {
+	node := &swarm.Node{ID: "node-1"}
+	node.Version.Index = 3
+	node.Spec.Availability = availability
+	node.Description.Hostname = "node-1-host"
+	return node
+}
+
+func buildModeService(id string, global bool) swarm.Service {
+	s := swarm.Service{ID: id}
+	s.Spec.Name = id + "-name"
+	if global {
+		s.Spec.Mode.Global = &swarm.GlobalService{}
+	} else {
+		s.Spec.Mode.Replicated = &swarm.ReplicatedService{}
+	}
+	return s
+}
+
+func buildPlacedTask(id string, serviceId string, nodeId string) swarm.Task {
+	return swarm.Task{
+		ID:           id,
+		ServiceID:    serviceId,
+		NodeID:       nodeId,
+		DesiredState: swarm.TaskStateRunning,
+		Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+	}
+}
@@ -0,0 +1,32 @@
+package comms
+
+import (
+	"bytes"
+	"github.com/eriklupander/dvizz/internal/pkg/render"
+	"net/http"
+	"strconv"
+)
+
+// getRenderedSvg handles GET /api/render.svg, drawing the current model as a static picture. It may be narrowed
+// down by ?stack={name}, ?service={id or name} and ?node={id or name}.
+func (server *EventServer) getRenderedSvg(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	query := r.URL.Query()
+	filter := render.Filter{Stack: query.Get("stack"), Service: query.Get("service"), Node: query.Get("node")}
+
+	buf := &bytes.Buffer{}
+	if err := render.SVG(buf, server.Model.Snapshot(), filter); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	// Chat unfurls and status pages should not show a stale picture for long
+	w.Header().Set("Cache-Control", "max-age=10")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,96 @@
+package comms
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// recentEvents is how many of the latest events sent are kept for subscribers resuming after a lost connection.
+const recentEvents = 1000
+
+// sentEvent is an event as sent to subscribers.
+type sentEvent struct {
+	seq    uint64
+	data   []byte // enveloped
+	stack  string
+	scoped bool
+}
+
+// remember keeps an event sent, forgetting the oldest one kept if there are too many. The lock must be held.
+func (server *EventServer) remember(event sentEvent) {
+	if len(server.recent) == recentEvents {
+		copy(server.recent, server.recent[1:])
+		server.recent = server.recent[:recentEvents-1]
+	}
+	server.recent = append(server.recent, event)
+}
+
+// since returns the events sent after seq, or false if some of them are no longer kept. The lock must be held.
+func (server *EventServer) since(seq uint64) ([]sentEvent, bool) {
+	if seq > server.seq {
+		return nil, false // numbered by an earlier run of dvizz
+	}
+	if seq == server.seq {
+		return nil, true
+	}
+	if len(server.recent) == 0 || server.recent[0].seq > seq+1 {
+		return nil, false
+	}
+	i := sort.Search(len(server.recent), func(i int) bool {
+		return server.recent[i].seq > seq
+	})
+	return server.recent[i:], true
+}
+
+// resume queues the events a subscriber missed, as one batch if it asked for batches. The lock must be held.
+func (server *EventServer) resume(conn *websocket.Conn, missed []sentEvent) {
+	filter, filtered := server.stackFilters[conn]
+	events := make([][]byte, 0, len(missed))
+	for _, event := range missed {
+		if filtered && event.scoped && event.stack != filter {
+			continue
+		}
+		events = append(events, event.data)
+	}
+	logrus.Infof("Resuming %v events for subscriber %v", len(events), conn.RemoteAddr().String())
+	if server.batchSubscribers[conn] && len(events) > 0 {
+		events = [][]byte{envelopeBatch(events, time.Now())}
+	}
+	for _, data := range events {
+		m, err := encodings(nil).encode(conn, data)
+		if err != nil {
+			logrus.Warnf("problem resuming subscriber: %v", err)
+			return
+		}
+		// A new subscriber has room for every event kept
+		server.subscribers[conn].enqueue(m)
+	}
+}
+
+// The headers of GET /api/snapshot telling the stream and the last event sent before the snapshot was taken.
+const (
+	streamHeader = "X-Dvizz-Stream"
+	seqHeader    = "X-Dvizz-Seq"
+)
+
+// getSnapshot handles GET /api/snapshot. The events sent up to the seq told are part of the snapshot, so
+// subscribers skip them when applying events on top of it.
+func (server *EventServer) getSnapshot(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	seq := atomic.LoadUint64(&server.seq)
+	snapshot := server.Model.Snapshot()
+	data, _ := json.Marshal(&snapshot)
+	w.Header().Set(streamHeader, server.stream)
+	w.Header().Set(seqHeader, strconv.FormatUint(seq, 10))
+	w.Header().Set("Access-Control-Expose-Headers", streamHeader+", "+seqHeader)
+	writeResponse(w, data)
+}
@@ -0,0 +1,86 @@
+package comms
+
+import (
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSince(t *testing.T) {
+	Convey("Given more events sent than are kept", t, func() {
+		server := &EventServer{}
+		for i := 0; i < recentEvents+10; i++ {
+			server.broadcast([][]byte{[]byte(`{"action":"update","type":"node","dnode":{"id":"n1"}}`)})
+		}
+		So(len(server.recent), ShouldEqual, recentEvents)
+		So(server.recent[0].seq, ShouldEqual, 11)
+
+		Convey("Then the events after a kept one are returned", func() {
+			missed, ok := server.since(recentEvents)
+			So(ok, ShouldBeTrue)
+			So(len(missed), ShouldEqual, 10)
+			So(missed[0].seq, ShouldEqual, recentEvents+1)
+		})
+		Convey("Then the events after the oldest kept but one are all returned", func() {
+			missed, ok := server.since(10)
+			So(ok, ShouldBeTrue)
+			So(len(missed), ShouldEqual, recentEvents)
+		})
+		Convey("Then nothing is missed after the last one", func() {
+			missed, ok := server.since(recentEvents + 10)
+			So(ok, ShouldBeTrue)
+			So(missed, ShouldBeEmpty)
+		})
+		Convey("Then events no longer kept cannot be resumed", func() {
+			_, ok := server.since(9)
+			So(ok, ShouldBeFalse)
+		})
+		Convey("Then events of an earlier run cannot be resumed", func() {
+			_, ok := server.since(recentEvents + 11)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestSubscriberResumes(t *testing.T) {
+	server := &EventServer{stackFilters: make(map[*websocket.Conn]string), batchSubscribers: make(map[*websocket.Conn]bool), legacySubscribers: make(map[*websocket.Conn]bool)}
+	server.init()
+	for _, id := range []string{"n1", "n2", "n3"} {
+		server.broadcast([][]byte{[]byte(`{"action":"update","type":"node","dnode":{"id":"` + id + `"}}`)})
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(server.registerChannel))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/start"
+
+	Convey("Given a subscriber resuming after the first event", t, func() {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?since=1&stream="+server.stream, nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("Then it is sent the events it missed", func() {
+			_, first, _ := conn.ReadMessage()
+			_, second, _ := conn.ReadMessage()
+			So(string(first), ShouldContainSubstring, `"seq":2`)
+			So(string(second), ShouldContainSubstring, `"seq":3`)
+		})
+	})
+
+	Convey("Given a subscriber resuming the stream of another run", t, func() {
+		_, resp, err := websocket.DefaultDialer.Dial(url+"?since=1&stream=other", nil)
+		Convey("Then it is told the events are gone", func() {
+			So(err, ShouldNotBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusGone)
+		})
+	})
+
+	Convey("Given a subscriber resuming from a later run", t, func() {
+		_, resp, err := websocket.DefaultDialer.Dial(url+"?since=42", nil)
+		Convey("Then it is told the events are gone", func() {
+			So(err, ShouldNotBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusGone)
+		})
+	})
+}
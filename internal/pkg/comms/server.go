@@ -2,6 +2,7 @@ package comms
 
 import (
 	"encoding/json"
+	"github.com/eriklupander/dvizz/pkg/model"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
@@ -10,10 +11,24 @@ import (
 	"os/signal"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+// ModelProvider gives access to the cluster model as last polled by the publisher.
+type ModelProvider interface {
+	Capacity(serviceId string) []model.DNodeCapacity
+	Networks() []model.DSwarmNetwork
+	Secrets() []model.DSecret
+	Configs() []model.DConfig
+	Volumes() []model.DVolume
+	Stacks() []model.DStack
+	Graph(serviceId string) model.DServiceGraph
+	Snapshot() model.DSnapshot
+}
+
 type IEventServer interface {
 	AddEventToSendQueue(data []byte)
 	InitializeEventSystem()
@@ -21,18 +36,47 @@ type IEventServer interface {
 }
 
 type EventServer struct {
+	// Number of the last event sent, first to be 64-bit aligned for atomic access
+	seq uint64
+	// Identifies this run, as the events are numbered anew with every run
+	stream string
+	// Guards the connections and the events kept for resuming subscribers
+	lock     sync.Mutex
 	upgrader websocket.Upgrader
 	// Create unbuffered channel
 	eventQueue chan []byte
 	// Pointer to docker client
 	Client *docker.Client
+	// Bearer token required by endpoints modifying the swarm
+	ApiToken string
+	// Resource usage of the tasks on this node, if collected
+	Stats StatsProvider
+	// The cluster model built by the publisher
+	Model ModelProvider
+	// Where published events are kept, if anywhere
+	History HistoryStore
 	// Web Socket connection registry (in case we have > 1 dashboards driven by this backend)
 	connectionRegistry []*websocket.Conn
+	// Sends the messages for each connection, in the order queued
+	subscribers map[*websocket.Conn]*subscriber
+	// The stack each connection subscribed to, if it asked for only one
+	stackFilters map[*websocket.Conn]string
+	// Connections that asked for the events of a poll cycle as one batch event
+	batchSubscribers map[*websocket.Conn]bool
+	// Connections that asked for the events as published before the envelope was introduced
+	legacySubscribers map[*websocket.Conn]bool
+	// The latest events sent, for subscribers resuming after a lost connection
+	recent []sentEvent
+	// Jobs started through the service action API
+	jobs *jobRegistry
 }
 
 func (server *EventServer) init() {
-	server.upgrader = websocket.Upgrader{} // use default options
+	// Compress messages for subscribers supporting permessage-deflate, and let them ask for a binary encoding
+	server.upgrader = websocket.Upgrader{EnableCompression: true, Subprotocols: []string{msgpackProtocol, jsonProtocol}}
 	server.connectionRegistry = make([]*websocket.Conn, 0)
+	server.subscribers = make(map[*websocket.Conn]*subscriber)
+	server.stream = newId()
 }
 
 func (server *EventServer) AddEventToSendQueue(data []byte) {
@@ -46,6 +90,12 @@ func (server *EventServer) InitializeEventSystem() {
 
 	logrus.Info("Starting WebSocket server at port 6969")
 
+	server.init()
+	server.jobs = newJobRegistry()
+	server.stackFilters = make(map[*websocket.Conn]string)
+	server.batchSubscribers = make(map[*websocket.Conn]bool)
+	server.legacySubscribers = make(map[*websocket.Conn]bool)
+
 	http.HandleFunc("/start", server.registerChannel)
 	http.HandleFunc("/nodes", server.getNodes)
 	http.HandleFunc("/services", server.getServices)
@@ -54,6 +104,26 @@ func (server *EventServer) InitializeEventSystem() {
 	http.HandleFunc("/networkreport", server.getNetworkReport)
 	http.HandleFunc("/servicereport", server.getServiceReport)
 	http.HandleFunc("/containers", server.getContainers)
+	http.HandleFunc("/api/services/", server.services)
+	http.HandleFunc("/api/tasks/", server.authenticated(server.tasks))
+	http.HandleFunc("/api/nodes/", server.authenticated(server.nodeAction))
+	http.HandleFunc("/api/jobs/", server.getJob)
+	http.HandleFunc("/api/stats/local", server.getLocalStats)
+	http.HandleFunc("/api/capacity", server.getCapacity)
+	http.HandleFunc("/api/networks", server.getNetworkModel)
+	http.HandleFunc("/api/secrets", server.getSecrets)
+	http.HandleFunc("/api/configs", server.getConfigs)
+	http.HandleFunc("/api/volumes", server.getVolumes)
+	http.HandleFunc("/api/stacks", server.getStacks)
+	http.HandleFunc("/api/graph", server.getGraph)
+	http.HandleFunc("/api/export", server.getExport)
+	http.HandleFunc("/api/render.svg", server.getRenderedSvg)
+	http.HandleFunc("/api/history", server.getHistory)
+	http.HandleFunc("/api/state", server.getState)
+	http.HandleFunc("/api/snapshots", server.getSnapshots)
+	http.HandleFunc("/api/diff", server.getDiff)
+	http.HandleFunc("/api/schema", server.getSchema)
+	http.HandleFunc("/api/snapshot", server.getSnapshot)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "static/"+r.URL.Path[1:])
 	})
@@ -74,16 +144,24 @@ func (server *EventServer) InitializeEventSystem() {
 }
 
 func (server *EventServer) Close() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
 	deletes := make([]int, 0)
 	for index, wsConn := range server.connectionRegistry {
 		adr := wsConn.RemoteAddr().String()
-		wsConn.Close()
+		server.subscribers[wsConn].close()
+		delete(server.subscribers, wsConn)
 		deletes = append(deletes, index)
 		logrus.Info("Gracefully shut down websocket connection to " + adr)
 	}
 	for _, deleteMe := range deletes {
 		server.connectionRegistry = remove(server.connectionRegistry, deleteMe)
 	}
+	if server.History != nil {
+		if err := server.History.Close(); err != nil {
+			logrus.Warnf("problem closing history: %v", err)
+		}
+	}
 }
 
 func (server *EventServer) getNodes(w http.ResponseWriter, r *http.Request) {
@@ -138,48 +216,22 @@ func (server *EventServer) getContainers(w http.ResponseWriter, r *http.Request)
 }
 
 func (server *EventServer) getNetworkReport(w http.ResponseWriter, r *http.Request) {
-
-	opts := docker.NetworkFilterOpts{
-		"scope": map[string]bool{
-			"swarm": true,
-		},
-	}
-	networks, err := server.Client.FilteredListNetworks(opts)
-	if err != nil {
-		panic(err)
-	}
-
-	services, err := server.Client.ListServices(docker.ListServicesOptions{})
-	if err != nil {
-		panic(err)
-	}
-
-	sm := make(map[string]string)
-	for _, s := range services {
-		sm[s.ID] = s.Spec.Name
-	}
-
-	report := make([]NetworkReport, 0)
-
-	for _, n := range networks {
-		nr := NetworkReport{ID: n.ID, Name: n.Name, Services: make([]string, 0)}
-		for _, s := range services {
-			for _, na := range s.Spec.TaskTemplate.Networks {
-				if na.Target == n.ID {
-					nr.Services = append(nr.Services, sm[s.ID])
-				}
-			}
-		}
-		report = append(report, nr)
-	}
-
+	report, _ := server.reports()
 	data, _ := json.Marshal(report)
 
 	writeResponse(w, data)
 }
 
 func (server *EventServer) getServiceReport(w http.ResponseWriter, r *http.Request) {
+	_, sReport := server.reports()
+	data, _ := json.Marshal(sReport)
 
+	writeResponse(w, data)
+}
+
+// reports lists the swarm scoped networks with the names of the services attached, and the services with their
+// networks. See /api/graph for which services can talk to each other.
+func (server *EventServer) reports() ([]NetworkReport, []ServiceReport) {
 	opts := docker.NetworkFilterOpts{
 		"scope": map[string]bool{
 			"swarm": true,
@@ -195,11 +247,6 @@ func (server *EventServer) getServiceReport(w http.ResponseWriter, r *http.Reque
 		panic(err)
 	}
 
-	sm := make(map[string]string)
-	for _, s := range services {
-		sm[s.ID] = s.Spec.Name
-	}
-
 	report := make([]NetworkReport, 0)
 
 	for _, n := range networks {
@@ -207,7 +254,7 @@ func (server *EventServer) getServiceReport(w http.ResponseWriter, r *http.Reque
 		for _, s := range services {
 			for _, na := range s.Spec.TaskTemplate.Networks {
 				if na.Target == n.ID {
-					nr.Services = append(nr.Services, sm[s.ID])
+					nr.Services = append(nr.Services, s.Spec.Name)
 				}
 			}
 		}
@@ -224,10 +271,7 @@ func (server *EventServer) getServiceReport(w http.ResponseWriter, r *http.Reque
 		}
 		sReport = append(sReport, sr)
 	}
-
-	data, _ := json.Marshal(sReport)
-
-	writeResponse(w, data)
+	return report, sReport
 }
 
 func find(networkId string, reports []NetworkReport) *NetworkReport {
@@ -253,54 +297,91 @@ type NetworkReport struct {
 func (server *EventServer) startEventSender() {
 	logrus.Infof("Starting event sender goroutine...")
 	for {
-		data := <-server.eventQueue
-		logrus.Debugf("About to send event: " + string(data))
-		server.broadcastDEvent(data)
-		time.Sleep(time.Millisecond * 50)
+		batch := server.nextBatch()
+		events := coalesce(batch)
+		logrus.Debugf("About to send %v events", len(events))
+		server.broadcast(events)
+		// History keeps every event, also the updates coalesced away
+		if server.History != nil {
+			if err := server.History.RecordBatch(batch); err != nil {
+				logrus.Warnf("problem recording events: %v", err)
+			}
+		}
 	}
 }
 
 func (server *EventServer) pinger() {
 	for {
 		time.Sleep(time.Second * 5)
+		server.lock.Lock()
 		deletes := make([]int, 0)
 		for index, wsConn := range server.connectionRegistry {
-			err := wsConn.WriteMessage(1, []byte(`{"msg":"PING"}`))
-			if err != nil {
-				// Detected disconnected channel. Need to clean up.
-				err := wsConn.Close()
-				if err != nil {
-					logrus.Warnf("problem closing connection: %v", err)
-				}
+			data := ping(time.Now())
+			if server.legacySubscribers[wsConn] {
+				data = legacyPing
+			}
+			m, err := encodings(nil).encode(wsConn, data)
+			if err != nil || !server.subscribers[wsConn].enqueue(m) {
+				// Detected disconnected or stalled channel. Need to clean up.
 				deletes = append(deletes, index)
 			}
 		}
-
-		// to mitigate problems with indicies not being updated when deleting multiple entries, we sort deleteMe
-		// DESC so the highest is deleted first.
-		sort.Slice(deletes, func(i, j int) bool {
-			return deletes[i] > deletes[j]
-		})
-
-		for _, deleteMe := range deletes {
-			server.connectionRegistry = remove(server.connectionRegistry, deleteMe)
-			logrus.Infof("Removed stale connection, new count is %v", len(server.connectionRegistry))
-		}
+		server.removeConnections(deletes)
+		server.lock.Unlock()
 	}
 }
 
-func (server *EventServer) broadcastDEvent(data []byte) {
+// broadcast queues a batch of events for every subscriber, as one batch event for those that asked for it.
+func (server *EventServer) broadcast(batch [][]byte) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	now := time.Now()
+	enveloped := make([][]byte, len(batch))
+	stacks := make([]string, len(batch))
+	scoped := make([]bool, len(batch))
+	for i, data := range batch {
+		enveloped[i] = server.envelope(data, now)
+		stacks[i], scoped[i] = stackOf(data)
+		server.remember(sentEvent{seq: atomic.LoadUint64(&server.seq), data: enveloped[i], stack: stacks[i], scoped: scoped[i]})
+	}
+	encoded := make(encodings)
 	deletes := make([]int, 0)
 	for index, wsConn := range server.connectionRegistry {
-		err := wsConn.WriteMessage(1, data)
-		if err != nil {
-			// Detected disconnected channel. Need to clean up.
-			logrus.Errorf("Could not write to channel: %v", err)
-			wsConn.Close()
-			deletes = append(deletes, index)
+		legacy := server.legacySubscribers[wsConn]
+		filter, filtered := server.stackFilters[wsConn]
+		events := make([][]byte, 0, len(batch))
+		for i := range batch {
+			if filtered && scoped[i] && stacks[i] != filter {
+				continue
+			}
+			if legacy {
+				events = append(events, batch[i])
+			} else {
+				events = append(events, enveloped[i])
+			}
+		}
+		if server.batchSubscribers[wsConn] && len(events) > 0 {
+			if legacy {
+				events = [][]byte{batchOf(events)}
+			} else {
+				events = [][]byte{envelopeBatch(events, now)}
+			}
+		}
+		for _, data := range events {
+			m, err := encoded.encode(wsConn, data)
+			if err != nil || !server.subscribers[wsConn].enqueue(m) {
+				// Detected disconnected or stalled channel. Need to clean up.
+				deletes = append(deletes, index)
+				break
+			}
 		}
 	}
 
+	server.removeConnections(deletes)
+}
+
+// removeConnections forgets the connections at the given indices of the registry.
+func (server *EventServer) removeConnections(deletes []int) {
 	// to mitigate problems with indicies not being updated when deleting multiple entries, we sort deleteMe
 	// DESC so the highest is deleted first.
 	sort.Slice(deletes, func(i, j int) bool {
@@ -308,7 +389,15 @@ func (server *EventServer) broadcastDEvent(data []byte) {
 	})
 
 	for _, deleteMe := range deletes {
+		if s, ok := server.subscribers[server.connectionRegistry[deleteMe]]; ok {
+			s.close()
+			delete(server.subscribers, server.connectionRegistry[deleteMe])
+		}
+		delete(server.stackFilters, server.connectionRegistry[deleteMe])
+		delete(server.batchSubscribers, server.connectionRegistry[deleteMe])
+		delete(server.legacySubscribers, server.connectionRegistry[deleteMe])
 		server.connectionRegistry = remove(server.connectionRegistry, deleteMe)
+		logrus.Infof("Removed stale connection, new count is %v", len(server.connectionRegistry))
 	}
 }
 
@@ -327,18 +416,95 @@ func (server *EventServer) registerChannel(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
+	scrubbing := r.URL.Query().Get("mode") == "scrub"
+	if scrubbing && server.History == nil {
+		http.Error(w, "No history kept", 404)
+		return
+	}
+	query := r.URL.Query()
+	var since uint64
+	if value := query.Get("since"); value != "" && !scrubbing && query.Get("version") != "1" {
+		var err error
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+			http.Error(w, "Bad since: "+err.Error(), 400)
+			return
+		}
+	}
 	header := make(map[string][]string)
 
 	header["Access-Control-Allow-Origin"] = []string{"*"}
-	c, err := server.upgrader.Upgrade(w, r, header)
+	if scrubbing {
+		c, err := server.upgrader.Upgrade(w, r, header)
+		if err != nil {
+			logrus.Errorf("upgrade: %v", err)
+			return
+		}
+		logrus.Infof("A subscriber connected from %v to scrub the history", c.RemoteAddr().String())
+		go server.scrub(c)
+		return
+	}
+
+	if since > 0 {
+		if stream := query.Get("stream"); stream != "" && stream != server.stream {
+			http.Error(w, "Events of stream "+stream+" are no longer kept", 410)
+			return
+		}
+		server.lock.Lock()
+		_, ok := server.since(since)
+		server.lock.Unlock()
+		if !ok {
+			http.Error(w, "Events since "+query.Get("since")+" are no longer kept", 410)
+			return
+		}
+	}
+	upgrader := server.upgrader
+	if query.Get("version") == "1" {
+		// Events as published before the envelope are only sent as JSON
+		upgrader.Subprotocols = nil
+	}
+	// Not holding the lock, as a slow handshake would hold up every subscriber
+	c, err := upgrader.Upgrade(w, r, header)
 	if err != nil {
 		logrus.Errorf("upgrade: %v", err)
 		return
 	}
+
+	// Register before any event is sent, so none is missed between those resumed and those broadcast
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	var missed []sentEvent
+	if since > 0 {
+		var ok bool
+		if missed, ok = server.since(since); !ok {
+			// Forgotten during the handshake. Told so by a goroutine of its own, as the lock is held
+			go closeForgotten(c, query.Get("since"))
+			return
+		}
+	}
 	server.connectionRegistry = append(server.connectionRegistry, c)
+	server.subscribers[c] = newSubscriber(c)
+	if stack := query.Get("stack"); stack != "" {
+		server.stackFilters[c] = stack
+	}
+	if query.Get("batch") == "true" {
+		server.batchSubscribers[c] = true
+	}
+	if query.Get("version") == "1" {
+		server.legacySubscribers[c] = true
+	}
+	if len(missed) > 0 {
+		server.resume(c, missed)
+	}
 	logrus.Infof("A new subscriber connected from %v. Current number of subscribers are: %v", c.RemoteAddr().String(), len(server.connectionRegistry))
 }
 
+// closeForgotten closes the connection of a subscriber whose missed events were forgotten, telling it to try again.
+func closeForgotten(c *websocket.Conn, since string) {
+	message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "events since "+since+" are no longer kept")
+	c.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+	c.Close()
+}
+
 func writeResponse(w http.ResponseWriter, json []byte) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Length", strconv.Itoa(len(json)))
@@ -0,0 +1,40 @@
+package comms
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// getStacks handles GET /api/stacks.
+func (server *EventServer) getStacks(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	stacks := server.Model.Stacks()
+	data, _ := json.Marshal(&stacks)
+	writeResponse(w, data)
+}
+
+// stackOf tells which stack a service, task or stack event belongs to. Other events, such as those of nodes and
+// networks, are not scoped to a stack and go to every subscriber.
+func stackOf(data []byte) (string, bool) {
+	event := struct {
+		Type     string
+		DService struct{ Stack string }
+		Dtask    struct{ Stack string }
+		Dstack   struct{ Name string }
+	}{}
+	if json.Unmarshal(data, &event) != nil {
+		return "", false
+	}
+	switch event.Type {
+	case "service":
+		return event.DService.Stack, true
+	case "task":
+		return event.Dtask.Stack, true
+	case "stack":
+		return event.Dstack.Name, true
+	}
+	return "", false
+}
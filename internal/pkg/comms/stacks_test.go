@@ -0,0 +1,24 @@
+package comms
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestStackOf(t *testing.T) {
+	Convey("Assert", t, func() {
+		stack, scoped := stackOf([]byte(`{"action":"start","type":"service","dservice":{"id":"s1","stack":"shop"}}`))
+		So(stack, ShouldEqual, "shop")
+		So(scoped, ShouldBeTrue)
+
+		stack, scoped = stackOf([]byte(`{"action":"update","type":"task","id":"t1","dtask":{"id":"t1","stack":""}}`))
+		So(stack, ShouldEqual, "")
+		So(scoped, ShouldBeTrue)
+
+		stack, _ = stackOf([]byte(`{"action":"update","type":"stack","dstack":{"name":"shop"}}`))
+		So(stack, ShouldEqual, "shop")
+
+		_, scoped = stackOf([]byte(`{"action":"start","type":"node","dnode":{"id":"n1"}}`))
+		So(scoped, ShouldBeFalse)
+	})
+}
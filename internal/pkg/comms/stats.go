@@ -0,0 +1,41 @@
+package comms
+
+import (
+	"encoding/json"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// StatsProvider samples the resource usage of the tasks running on the local node.
+type StatsProvider interface {
+	LocalStats() ([]model.DTaskStats, error)
+}
+
+// InitializeAgent serves the resource usage of the local tasks only, for the dvizz instance on a manager to collect.
+func (server *EventServer) InitializeAgent() {
+	if server.Stats == nil {
+		panic("Cannot initialize agent, stats provider not assigned.")
+	}
+	http.HandleFunc("/api/stats/local", server.getLocalStats)
+
+	logrus.Info("Starting agent at port 6969")
+	err := http.ListenAndServe(":6969", nil)
+	if err != nil {
+		panic("ListenAndServe: " + err.Error())
+	}
+}
+
+func (server *EventServer) getLocalStats(w http.ResponseWriter, r *http.Request) {
+	if server.Stats == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	stats, err := server.Stats.LocalStats()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	data, _ := json.Marshal(&stats)
+	writeResponse(w, data)
+}
@@ -0,0 +1,62 @@
+package comms
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// sendQueue is how many messages may wait to be sent to a subscriber before it is disconnected for being too slow.
+// There is room for every event a resuming subscriber missed, and then as many more.
+const sendQueue = 2 * recentEvents
+
+// subscriber writes the messages for one connection from a goroutine of its own, so a slow subscriber holds up
+// neither the others nor the event server.
+type subscriber struct {
+	conn  *websocket.Conn
+	queue chan message
+	// Closed once a write failed, the connection being gone
+	gone chan struct{}
+}
+
+func newSubscriber(conn *websocket.Conn) *subscriber {
+	s := &subscriber{conn: conn, queue: make(chan message, sendQueue), gone: make(chan struct{})}
+	go s.send()
+	return s
+}
+
+// send writes the queued messages until the subscriber is closed or a write fails.
+func (s *subscriber) send() {
+	for m := range s.queue {
+		if err := m.write(s.conn); err != nil {
+			logrus.Errorf("Could not write to channel: %v", err)
+			close(s.gone)
+			s.conn.Close()
+			for range s.queue {
+				// Dropped, until the event server forgets the subscriber
+			}
+			return
+		}
+	}
+}
+
+// enqueue queues a message without waiting, returning false if the subscriber is gone or its queue is full.
+func (s *subscriber) enqueue(m message) bool {
+	select {
+	case <-s.gone:
+		return false
+	default:
+	}
+	select {
+	case s.queue <- m:
+		return true
+	default:
+		logrus.Warnf("Subscriber %v is too slow, %v messages are waiting", s.conn.RemoteAddr().String(), len(s.queue))
+		return false
+	}
+}
+
+// close stops sending and closes the connection, also interrupting a write in progress.
+func (s *subscriber) close() {
+	close(s.queue)
+	s.conn.Close()
+}
@@ -0,0 +1,59 @@
+package comms
+
+import (
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStalledSubscriberDisconnected(t *testing.T) {
+	server := &EventServer{stackFilters: make(map[*websocket.Conn]string), batchSubscribers: make(map[*websocket.Conn]bool), legacySubscribers: make(map[*websocket.Conn]bool)}
+	server.init()
+	registered := make(chan bool, 2)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.registerChannel(w, r)
+		registered <- true
+	}))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/start"
+
+	Convey("Given a stalled subscriber and another one", t, func() {
+		stalledConn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		So(err, ShouldBeNil)
+		defer stalledConn.Close()
+		<-registered
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		<-registered
+
+		server.lock.Lock()
+		stalled := server.connectionRegistry[0]
+		// Room for one message, and nothing sending it
+		server.subscribers[stalled] = &subscriber{conn: stalled, queue: make(chan message, 1), gone: make(chan struct{})}
+		server.lock.Unlock()
+
+		Convey("When more events are broadcast than the stalled subscriber has room for", func() {
+			server.broadcast([][]byte{[]byte(`{"action":"update","type":"node","dnode":{"id":"n1"}}`)})
+			server.broadcast([][]byte{[]byte(`{"action":"update","type":"node","dnode":{"id":"n2"}}`)})
+
+			Convey("Then the stalled subscriber is disconnected, and the other is sent every event", func() {
+				server.lock.Lock()
+				count, kept := len(server.connectionRegistry), server.subscribers[stalled] != nil
+				server.lock.Unlock()
+				So(count, ShouldEqual, 1)
+				So(kept, ShouldBeFalse)
+				_, _, err := stalledConn.ReadMessage()
+				So(err, ShouldNotBeNil)
+
+				_, first, _ := conn.ReadMessage()
+				_, second, _ := conn.ReadMessage()
+				So(string(first), ShouldContainSubstring, `"n1"`)
+				So(string(second), ShouldContainSubstring, `"n2"`)
+			})
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package comms
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// getNetworkModel handles GET /api/networks, the converted counterpart of the raw /networks listing.
+func (server *EventServer) getNetworkModel(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	networks := server.Model.Networks()
+	data, _ := json.Marshal(&networks)
+	writeResponse(w, data)
+}
+
+// getSecrets handles GET /api/secrets. Only metadata is known, never the secret values.
+func (server *EventServer) getSecrets(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	secrets := server.Model.Secrets()
+	data, _ := json.Marshal(&secrets)
+	writeResponse(w, data)
+}
+
+// getConfigs handles GET /api/configs.
+func (server *EventServer) getConfigs(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	configs := server.Model.Configs()
+	data, _ := json.Marshal(&configs)
+	writeResponse(w, data)
+}
+
+// getVolumes handles GET /api/volumes.
+func (server *EventServer) getVolumes(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	volumes := server.Model.Volumes()
+	data, _ := json.Marshal(&volumes)
+	writeResponse(w, data)
+}
+
+// getGraph handles GET /api/graph, optionally narrowed down to the services one service can talk to by ?service={id}.
+func (server *EventServer) getGraph(w http.ResponseWriter, r *http.Request) {
+	if server.Model == nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	graph := server.Model.Graph(r.URL.Query().Get("service"))
+	data, _ := json.Marshal(&graph)
+	writeResponse(w, data)
+}
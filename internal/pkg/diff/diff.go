@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// TaskChanged tells whether a task changed state or error. Other changes of a task, such as its updated time, are
+// not considered.
+func TaskChanged(last []model.DTask, current []model.DTask) Changed {
+	return func(i, j int) bool {
+		return last[i].Status != current[j].Status || last[i].Err != current[j].Err
+	}
+}
+
+// Snapshots compares two snapshots with the same semantics as the events published live, listing the changed
+// fields of every changed entity.
+func Snapshots(from model.DSnapshot, fromTime time.Time, to model.DSnapshot, toTime time.Time) model.DSnapshotDiff {
+	result := model.DSnapshotDiff{From: fromTime, To: toTime}
+
+	r := Compute(Nodes(from.Nodes), Nodes(to.Nodes), func(i, j int) bool {
+		return !reflect.DeepEqual(from.Nodes[i], to.Nodes[j])
+	})
+	result.Nodes.Added, result.Nodes.Removed, result.Nodes.Changed = make([]model.DNode, 0), make([]model.DNode, 0), make([]model.DChange, 0)
+	for _, j := range r.Added {
+		result.Nodes.Added = append(result.Nodes.Added, to.Nodes[j])
+	}
+	for _, i := range r.Removed {
+		result.Nodes.Removed = append(result.Nodes.Removed, from.Nodes[i])
+	}
+	for k, j := range r.Changed {
+		n := to.Nodes[j]
+		result.Nodes.Changed = append(result.Nodes.Changed, model.DChange{Id: n.Id, Name: n.Name, Fields: Fields(from.Nodes[r.ChangedFrom[k]], n)})
+	}
+
+	r = Compute(Services(from.Services), Services(to.Services), func(i, j int) bool {
+		return !reflect.DeepEqual(from.Services[i], to.Services[j])
+	})
+	result.Services.Added, result.Services.Removed, result.Services.Changed = make([]model.DService, 0), make([]model.DService, 0), make([]model.DChange, 0)
+	for _, j := range r.Added {
+		result.Services.Added = append(result.Services.Added, to.Services[j])
+	}
+	for _, i := range r.Removed {
+		result.Services.Removed = append(result.Services.Removed, from.Services[i])
+	}
+	for k, j := range r.Changed {
+		s := to.Services[j]
+		result.Services.Changed = append(result.Services.Changed, model.DChange{Id: s.Id, Name: s.Name, Fields: Fields(from.Services[r.ChangedFrom[k]], s)})
+	}
+
+	r = Compute(Tasks(from.Tasks), Tasks(to.Tasks), TaskChanged(from.Tasks, to.Tasks))
+	result.Tasks.Added, result.Tasks.Removed, result.Tasks.Changed = make([]model.DTask, 0), make([]model.DTask, 0), make([]model.DChange, 0)
+	for _, j := range r.Added {
+		result.Tasks.Added = append(result.Tasks.Added, to.Tasks[j])
+	}
+	for _, i := range r.Removed {
+		result.Tasks.Removed = append(result.Tasks.Removed, from.Tasks[i])
+	}
+	for k, j := range r.Changed {
+		t := to.Tasks[j]
+		result.Tasks.Changed = append(result.Tasks.Changed, model.DChange{Id: t.Id, Name: t.Name, Fields: Fields(from.Tasks[r.ChangedFrom[k]], t)})
+	}
+
+	r = Compute(Networks(from.Networks), Networks(to.Networks), func(i, j int) bool {
+		return !reflect.DeepEqual(from.Networks[i], to.Networks[j])
+	})
+	result.Networks.Added, result.Networks.Removed, result.Networks.Changed = make([]model.DSwarmNetwork, 0), make([]model.DSwarmNetwork, 0), make([]model.DChange, 0)
+	for _, j := range r.Added {
+		result.Networks.Added = append(result.Networks.Added, to.Networks[j])
+	}
+	for _, i := range r.Removed {
+		result.Networks.Removed = append(result.Networks.Removed, from.Networks[i])
+	}
+	for k, j := range r.Changed {
+		n := to.Networks[j]
+		result.Networks.Changed = append(result.Networks.Changed, model.DChange{Id: n.Id, Name: n.Name, Fields: Fields(from.Networks[r.ChangedFrom[k]], n)})
+	}
+	return result
+}
+
+// Fields compares the top level fields of two entities by their JSON representation, sorted by field name.
+func Fields(from interface{}, to interface{}) []model.DFieldChange {
+	before := make(map[string]json.RawMessage)
+	after := make(map[string]json.RawMessage)
+	data, _ := json.Marshal(from)
+	json.Unmarshal(data, &before)
+	data, _ = json.Marshal(to)
+	json.Unmarshal(data, &after)
+
+	result := make([]model.DFieldChange, 0)
+	for field, value := range after {
+		if old, ok := before[field]; !ok || !bytes.Equal(old, value) {
+			result = append(result, model.DFieldChange{Field: field, From: old, To: value})
+		}
+	}
+	for field, old := range before {
+		if _, ok := after[field]; !ok {
+			result = append(result, model.DFieldChange{Field: field, From: old})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Field < result[j].Field
+	})
+	return result
+}
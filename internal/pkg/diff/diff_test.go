@@ -0,0 +1,70 @@
+package diff
+
+import (
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestTasksOnlyChangeByStateOrError(t *testing.T) {
+	now := time.Now()
+	last := []DTask{{Id: "t1", Status: "running"}, {Id: "t2", Status: "running"}, {Id: "t3", Status: "running"}}
+	current := []DTask{{Id: "t1", Status: "running", UpdatedAt: now}, {Id: "t2", Status: "failed"}, {Id: "t4", Status: "preparing"}}
+
+	result := Compute(Tasks(last), Tasks(current), TaskChanged(last, current))
+
+	Convey("Assert", t, func() {
+		So(result.Added, ShouldResemble, []int{2})
+		So(result.Removed, ShouldResemble, []int{2})
+		So(result.Changed, ShouldResemble, []int{1})
+		So(result.ChangedFrom, ShouldResemble, []int{1})
+	})
+}
+
+func TestServicesChangeAsTheCallerTells(t *testing.T) {
+	last := []DService{{Id: "s1", Replicas: 1, Image: "nginx:1.15"}, {Id: "s2"}}
+	current := []DService{{Id: "s2"}, {Id: "s1", Replicas: 2, Image: "nginx:1.16"}}
+
+	result := Compute(Services(last), Services(current), func(i, j int) bool {
+		return last[i].Image != current[j].Image
+	})
+
+	Convey("Assert", t, func() {
+		So(result.Added, ShouldBeEmpty)
+		So(result.Removed, ShouldBeEmpty)
+		So(result.Changed, ShouldResemble, []int{1})
+		So(result.ChangedFrom, ShouldResemble, []int{0})
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	from := DSnapshot{
+		Nodes:    []DNode{{Id: "n1", Name: "worker-1", Availability: "active"}},
+		Services: []DService{{Id: "s1", Name: "web", Image: "nginx:1.15"}},
+		Tasks:    []DTask{{Id: "t1", Status: "running"}},
+	}
+	to := DSnapshot{
+		Nodes:    []DNode{{Id: "n1", Name: "worker-1", Availability: "drain"}},
+		Services: []DService{{Id: "s1", Name: "web", Image: "nginx:1.16"}},
+		Tasks:    []DTask{{Id: "t2", Status: "running"}},
+		Networks: []DSwarmNetwork{{Id: "net1"}},
+	}
+
+	result := Snapshots(from, time.Unix(0, 0), to, time.Unix(60, 0))
+
+	Convey("Assert", t, func() {
+		So(len(result.Nodes.Changed), ShouldEqual, 1)
+		So(result.Nodes.Changed[0].Name, ShouldEqual, "worker-1")
+		So(len(result.Nodes.Changed[0].Fields), ShouldEqual, 1)
+		So(result.Nodes.Changed[0].Fields[0].Field, ShouldEqual, "availability")
+		So(string(result.Nodes.Changed[0].Fields[0].From), ShouldEqual, `"active"`)
+		So(string(result.Nodes.Changed[0].Fields[0].To), ShouldEqual, `"drain"`)
+		So(result.Services.Changed[0].Fields[0].Field, ShouldEqual, "image")
+		So(result.Tasks.Added[0].Id, ShouldEqual, "t2")
+		So(result.Tasks.Removed[0].Id, ShouldEqual, "t1")
+		So(result.Tasks.Changed, ShouldBeEmpty)
+		So(len(result.Networks.Added), ShouldEqual, 1)
+		So(result.Networks.Removed, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,50 @@
+package diff
+
+// Entities adapts a listing of entities for diffing, much like sort.Interface adapts a collection for sorting.
+type Entities interface {
+	Len() int
+	// Id returns the GetId of entity i.
+	Id(i int) string
+}
+
+// Changed tells whether entity i of the last listing differs from entity j of the current listing, both having the
+// same id.
+type Changed func(i, j int) bool
+
+// Result holds the indices of the entities added to and changed in the current listing, and of those removed from
+// the last listing, in listing order. ChangedFrom holds the index in the last listing of every changed entity.
+type Result struct {
+	Added       []int
+	Removed     []int
+	Changed     []int
+	ChangedFrom []int
+}
+
+// Compute diffs two listings by id in O(n). A nil changed detects no changes.
+func Compute(last Entities, current Entities, changed Changed) Result {
+	index := make(map[string]int, last.Len())
+	for i := 0; i < last.Len(); i++ {
+		index[last.Id(i)] = i
+	}
+
+	result := Result{Added: make([]int, 0), Removed: make([]int, 0), Changed: make([]int, 0), ChangedFrom: make([]int, 0)}
+	kept := make([]bool, last.Len())
+	for j := 0; j < current.Len(); j++ {
+		i, ok := index[current.Id(j)]
+		if !ok {
+			result.Added = append(result.Added, j)
+			continue
+		}
+		kept[i] = true
+		if changed != nil && changed(i, j) {
+			result.Changed = append(result.Changed, j)
+			result.ChangedFrom = append(result.ChangedFrom, i)
+		}
+	}
+	for i, k := range kept {
+		if !k {
+			result.Removed = append(result.Removed, i)
+		}
+	}
+	return result
+}
@@ -0,0 +1,67 @@
+package diff
+
+import (
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"strconv"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	last := []DTask{{Id: "t1"}, {Id: "t2"}, {Id: "t3"}}
+	current := []DTask{{Id: "t3"}, {Id: "t4"}, {Id: "t1", Status: "failed"}}
+
+	result := Compute(Tasks(last), Tasks(current), func(i, j int) bool {
+		return last[i].Status != current[j].Status
+	})
+
+	Convey("Assert", t, func() {
+		So(result.Added, ShouldResemble, []int{1})
+		So(result.Removed, ShouldResemble, []int{1})
+		So(result.Changed, ShouldResemble, []int{2})
+	})
+}
+
+func TestComputeWithoutChangeDetection(t *testing.T) {
+	result := Compute(Nodes{{Id: "n1", State: "ready"}}, Nodes{{Id: "n1", State: "down"}}, nil)
+
+	Convey("Assert", t, func() {
+		So(result.Added, ShouldBeEmpty)
+		So(result.Removed, ShouldBeEmpty)
+		So(result.Changed, ShouldBeEmpty)
+	})
+}
+
+// buildTasks returns count tasks, one in a hundred replaced by a new task and one in a hundred failed if shifted.
+func buildTasks(count int, shifted bool) []DTask {
+	result := make([]DTask, count)
+	for i := range result {
+		result[i] = DTask{Id: "task-" + strconv.Itoa(i), Name: "web." + strconv.Itoa(i), ServiceId: "s1", NodeId: "n1", Status: "running"}
+		if shifted && i%100 == 0 {
+			result[i].Id = "task-new-" + strconv.Itoa(i)
+		}
+		if shifted && i%100 == 1 {
+			result[i].Status = "failed"
+		}
+	}
+	return result
+}
+
+func BenchmarkTasks10k(b *testing.B) {
+	last, current := buildTasks(10000, false), buildTasks(10000, true)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		r := Compute(Tasks(last), Tasks(current), TaskChanged(last, current))
+		if len(r.Added) != 100 || len(r.Removed) != 100 || len(r.Changed) != 100 {
+			b.Fatalf("unexpected diff %v %v %v", len(r.Added), len(r.Removed), len(r.Changed))
+		}
+	}
+}
+
+func BenchmarkTasks10kUnchanged(b *testing.B) {
+	last, current := buildTasks(10000, false), buildTasks(10000, false)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		Compute(Tasks(last), Tasks(current), TaskChanged(last, current))
+	}
+}
@@ -0,0 +1,50 @@
+package diff
+
+import "github.com/eriklupander/dvizz/pkg/model"
+
+// Adapters of the entity listings to Entities. The entities of a Result are picked from the listings by index.
+
+type Nodes []model.DNode
+
+func (l Nodes) Len() int        { return len(l) }
+func (l Nodes) Id(i int) string { return l[i].GetId() }
+
+type Services []model.DService
+
+func (l Services) Len() int        { return len(l) }
+func (l Services) Id(i int) string { return l[i].GetId() }
+
+type Tasks []model.DTask
+
+func (l Tasks) Len() int        { return len(l) }
+func (l Tasks) Id(i int) string { return l[i].GetId() }
+
+type Networks []model.DSwarmNetwork
+
+func (l Networks) Len() int        { return len(l) }
+func (l Networks) Id(i int) string { return l[i].GetId() }
+
+type Secrets []model.DSecret
+
+func (l Secrets) Len() int        { return len(l) }
+func (l Secrets) Id(i int) string { return l[i].GetId() }
+
+type Configs []model.DConfig
+
+func (l Configs) Len() int        { return len(l) }
+func (l Configs) Id(i int) string { return l[i].GetId() }
+
+type Volumes []model.DVolume
+
+func (l Volumes) Len() int        { return len(l) }
+func (l Volumes) Id(i int) string { return l[i].GetId() }
+
+type Stacks []model.DStack
+
+func (l Stacks) Len() int        { return len(l) }
+func (l Stacks) Id(i int) string { return l[i].GetId() }
+
+type Edges []model.DEdge
+
+func (l Edges) Len() int        { return len(l) }
+func (l Edges) Id(i int) string { return l[i].GetId() }
@@ -0,0 +1,142 @@
+package export
+
+import (
+	"fmt"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"io"
+)
+
+// Supported formats.
+const (
+	FormatDot       = "dot"
+	FormatGraphML   = "graphml"
+	FormatMermaid   = "mermaid"
+	FormatCytoscape = "cytoscape"
+)
+
+// Kinds of vertices.
+const (
+	kindNode    = "node"
+	kindService = "service"
+	kindTask    = "task"
+	kindNetwork = "network"
+)
+
+type vertex struct {
+	id    string
+	label string
+	kind  string
+	group string // stack of a service, if any
+}
+
+type edge struct {
+	source string
+	target string
+	label  string
+}
+
+type graph struct {
+	vertices []vertex
+	edges    []edge
+}
+
+// Render writes the snapshot as a graph in the given format. Services are connected to their tasks and networks,
+// tasks to the nodes they run on.
+func Render(w io.Writer, format string, snapshot model.DSnapshot) error {
+	g := build(snapshot)
+	switch format {
+	case FormatDot:
+		return writeDot(w, g)
+	case FormatGraphML:
+		return writeGraphML(w, g)
+	case FormatMermaid:
+		return writeMermaid(w, g)
+	case FormatCytoscape:
+		return writeCytoscape(w, g)
+	}
+	return fmt.Errorf("unknown format %v, expected one of dot, graphml, mermaid or cytoscape", format)
+}
+
+// ContentType tells the media type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatGraphML:
+		return "application/xml"
+	case FormatCytoscape:
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// ForStack narrows the snapshot down to the services and tasks of one stack, the networks those services are
+// attached to and the nodes those tasks run on.
+func ForStack(snapshot model.DSnapshot, stack string) model.DSnapshot {
+	result := model.DSnapshot{
+		Nodes:    make([]model.DNode, 0),
+		Services: make([]model.DService, 0),
+		Tasks:    make([]model.DTask, 0),
+		Networks: make([]model.DSwarmNetwork, 0),
+	}
+	services := make(map[string]bool)
+	for _, s := range snapshot.Services {
+		if s.Stack == stack {
+			services[s.Id] = true
+			result.Services = append(result.Services, s)
+		}
+	}
+	nodes := make(map[string]bool)
+	for _, t := range snapshot.Tasks {
+		if services[t.ServiceId] {
+			nodes[t.NodeId] = true
+			result.Tasks = append(result.Tasks, t)
+		}
+	}
+	for _, n := range snapshot.Nodes {
+		if nodes[n.Id] {
+			result.Nodes = append(result.Nodes, n)
+		}
+	}
+	for _, n := range snapshot.Networks {
+		for _, s := range n.Services {
+			if services[s] {
+				result.Networks = append(result.Networks, n)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func build(snapshot model.DSnapshot) graph {
+	g := graph{vertices: make([]vertex, 0), edges: make([]edge, 0)}
+	known := make(map[string]bool)
+	for _, n := range snapshot.Nodes {
+		g.vertices = append(g.vertices, vertex{id: n.Id, label: n.Name, kind: kindNode})
+		known[n.Id] = true
+	}
+	for _, s := range snapshot.Services {
+		g.vertices = append(g.vertices, vertex{id: s.Id, label: s.Name, kind: kindService, group: s.Stack})
+		known[s.Id] = true
+	}
+	for _, n := range snapshot.Networks {
+		g.vertices = append(g.vertices, vertex{id: n.Id, label: n.Name, kind: kindNetwork})
+		known[n.Id] = true
+	}
+	for _, t := range snapshot.Tasks {
+		g.vertices = append(g.vertices, vertex{id: t.Id, label: t.Name, kind: kindTask})
+		if known[t.ServiceId] {
+			g.edges = append(g.edges, edge{source: t.ServiceId, target: t.Id, label: "runs"})
+		}
+		if known[t.NodeId] {
+			g.edges = append(g.edges, edge{source: t.Id, target: t.NodeId, label: "on"})
+		}
+	}
+	for _, n := range snapshot.Networks {
+		for _, s := range n.Services {
+			if known[s] {
+				g.edges = append(g.edges, edge{source: s, target: n.Id, label: "attached"})
+			}
+		}
+	}
+	return g
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func buildSnapshot() DSnapshot {
+	return DSnapshot{
+		Nodes:    []DNode{{Id: "n1", Name: "worker-1"}},
+		Services: []DService{{Id: "s1", Name: "shop_web", Stack: "shop"}, {Id: "s2", Name: "monitor"}},
+		Tasks:    []DTask{{Id: "t1", Name: "nginx.1", ServiceId: "s1", NodeId: "n1"}, {Id: "t2", Name: "prom.1", ServiceId: "s2", NodeId: "n1"}},
+		Networks: []DSwarmNetwork{{Id: "net1", Name: "shop_default", Services: []string{"s1"}}},
+	}
+}
+
+func TestRenderDot(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := Render(buf, "dot", buildSnapshot())
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldStartWith, "digraph dvizz {")
+		So(buf.String(), ShouldContainSubstring, `"s1" [label="shop_web", shape=box];`)
+		So(buf.String(), ShouldContainSubstring, `"t1" -> "n1" [label="on"];`)
+		So(buf.String(), ShouldContainSubstring, `"s1" -> "net1" [label="attached"];`)
+	})
+}
+
+func TestRenderGraphML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := Render(buf, "graphml", buildSnapshot())
+	doc := graphML{}
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(xml.Unmarshal(buf.Bytes(), &doc), ShouldBeNil)
+		So(len(doc.Graph.Nodes), ShouldEqual, 6)
+		So(len(doc.Graph.Edges), ShouldEqual, 5)
+	})
+}
+
+func TestRenderMermaid(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := Render(buf, "mermaid", buildSnapshot())
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldStartWith, "graph LR\n")
+		So(buf.String(), ShouldContainSubstring, "  subgraph stack_shop[\"shop\"]\n    service_s1[\"shop_web\"]\n  end\n")
+		So(buf.String(), ShouldContainSubstring, "node_n1[[\"worker-1\"]]")
+		So(buf.String(), ShouldContainSubstring, "service_s1 -->|runs| task_t1")
+	})
+}
+
+func TestRenderCytoscape(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := Render(buf, "cytoscape", buildSnapshot())
+	doc := cytoscapeElements{}
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(json.Unmarshal(buf.Bytes(), &doc), ShouldBeNil)
+		So(len(doc.Elements.Nodes), ShouldEqual, 6)
+		So(doc.Elements.Nodes[1].Data["stack"], ShouldEqual, "shop")
+		So(doc.Elements.Edges[0].Data, ShouldResemble, map[string]string{"id": "e0", "source": "s1", "target": "t1", "label": "runs"})
+	})
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	Convey("Assert", t, func() {
+		So(Render(&bytes.Buffer{}, "png", buildSnapshot()), ShouldNotBeNil)
+	})
+}
+
+func TestForStack(t *testing.T) {
+	snapshot := ForStack(buildSnapshot(), "shop")
+	Convey("Assert", t, func() {
+		So(len(snapshot.Services), ShouldEqual, 1)
+		So(len(snapshot.Tasks), ShouldEqual, 1)
+		So(len(snapshot.Nodes), ShouldEqual, 1)
+		So(len(snapshot.Networks), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,194 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var dotShapes = map[string]string{
+	kindNode:    "box3d",
+	kindService: "box",
+	kindTask:    "ellipse",
+	kindNetwork: "hexagon",
+}
+
+func writeDot(w io.Writer, g graph) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph dvizz {")
+	fmt.Fprintln(b, "  rankdir=LR;")
+	for _, v := range g.vertices {
+		fmt.Fprintf(b, "  %v [label=%v, shape=%v];\n", strconv.Quote(v.id), strconv.Quote(v.label), dotShapes[v.kind])
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(b, "  %v -> %v [label=%v];\n", strconv.Quote(e.source), strconv.Quote(e.target), strconv.Quote(e.label))
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	Id       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	Id          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeGraphML(w io.Writer, g graph) error {
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{Id: "label", For: "all", AttrName: "label", AttrType: "string"},
+			{Id: "kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{Id: "stack", For: "node", AttrName: "stack", AttrType: "string"},
+		},
+		Graph: graphMLGraph{Id: "dvizz", EdgeDefault: "directed"},
+	}
+	for _, v := range g.vertices {
+		n := graphMLNode{Id: v.id, Data: []graphMLData{{Key: "label", Value: v.label}, {Key: "kind", Value: v.kind}}}
+		if v.group != "" {
+			n.Data = append(n.Data, graphMLData{Key: "stack", Value: v.group})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, n)
+	}
+	for _, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: e.source, Target: e.target, Data: []graphMLData{{Key: "label", Value: e.label}}})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func writeMermaid(w io.Writer, g graph) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "graph LR")
+
+	// Services of the same stack are drawn together
+	stacks := make([]string, 0)
+	grouped := make(map[string][]vertex)
+	for _, v := range g.vertices {
+		if v.group == "" {
+			fmt.Fprintf(b, "  %v\n", mermaidVertex(v))
+			continue
+		}
+		if _, ok := grouped[v.group]; !ok {
+			stacks = append(stacks, v.group)
+		}
+		grouped[v.group] = append(grouped[v.group], v)
+	}
+	for _, stack := range stacks {
+		fmt.Fprintf(b, "  subgraph %v[\"%v\"]\n", mermaidId("stack", stack), mermaidLabel(stack))
+		for _, v := range grouped[stack] {
+			fmt.Fprintf(b, "    %v\n", mermaidVertex(v))
+		}
+		fmt.Fprintln(b, "  end")
+	}
+
+	kinds := make(map[string]string)
+	for _, v := range g.vertices {
+		kinds[v.id] = v.kind
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(b, "  %v -->|%v| %v\n", mermaidId(kinds[e.source], e.source), mermaidLabel(e.label), mermaidId(kinds[e.target], e.target))
+	}
+	return b.Flush()
+}
+
+func mermaidVertex(v vertex) string {
+	id := mermaidId(v.kind, v.id)
+	label := mermaidLabel(v.label)
+	switch v.kind {
+	case kindNode:
+		return fmt.Sprintf("%v[[\"%v\"]]", id, label)
+	case kindTask:
+		return fmt.Sprintf("%v([\"%v\"])", id, label)
+	case kindNetwork:
+		return fmt.Sprintf("%v{{\"%v\"}}", id, label)
+	}
+	return fmt.Sprintf("%v[\"%v\"]", id, label)
+}
+
+// mermaidId makes an id Mermaid accepts, prefixed by kind as node and task ids may look alike.
+func mermaidId(kind string, id string) string {
+	return kind + "_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, id)
+}
+
+func mermaidLabel(label string) string {
+	return strings.Replace(label, "\"", "#quot;", -1)
+}
+
+type cytoscapeElements struct {
+	Elements struct {
+		Nodes []cytoscapeElement `json:"nodes"`
+		Edges []cytoscapeElement `json:"edges"`
+	} `json:"elements"`
+}
+
+type cytoscapeElement struct {
+	Data map[string]string `json:"data"`
+}
+
+func writeCytoscape(w io.Writer, g graph) error {
+	doc := cytoscapeElements{}
+	doc.Elements.Nodes = make([]cytoscapeElement, 0, len(g.vertices))
+	doc.Elements.Edges = make([]cytoscapeElement, 0, len(g.edges))
+	for _, v := range g.vertices {
+		data := map[string]string{"id": v.id, "label": v.label, "kind": v.kind}
+		if v.group != "" {
+			data["stack"] = v.group
+		}
+		doc.Elements.Nodes = append(doc.Elements.Nodes, cytoscapeElement{Data: data})
+	}
+	for idx, e := range g.edges {
+		data := map[string]string{"id": "e" + strconv.Itoa(idx), "source": e.source, "target": e.target, "label": e.label}
+		doc.Elements.Edges = append(doc.Elements.Edges, cytoscapeElement{Data: data})
+	}
+	return json.NewEncoder(w).Encode(&doc)
+}
@@ -0,0 +1,193 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/eriklupander/dvizz/pkg/model"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// StateAt rebuilds the nodes, services, tasks and networks as they were at t. It starts out from the latest
+// snapshot taken at or before t and replays the events recorded after that snapshot, up to t.
+func (s *Store) StateAt(t time.Time) (model.DSnapshot, error) {
+	snapshot := model.DSnapshot{}
+	from := time.Time{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(snapshotsBucket).Cursor()
+		// Seek lands on the first snapshot after t, if any
+		k, v := c.Seek(key(t, ^uint64(0)))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		if k == nil {
+			return nil
+		}
+		from = timeOf(k)
+		return json.Unmarshal(v, &snapshot)
+	})
+	if err != nil {
+		return snapshot, err
+	}
+
+	state := newState(snapshot)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		k, v := c.First()
+		if !from.IsZero() {
+			k, v = c.Seek(key(from, 0))
+		}
+		for ; k != nil && !timeOf(k).After(t); k, v = c.Next() {
+			event := model.DHistoryEvent{}
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			if err := state.apply(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return state.snapshot(), err
+}
+
+// state is a snapshot keyed by id, for events to be applied to.
+type state struct {
+	nodes    map[string]model.DNode
+	services map[string]model.DService
+	tasks    map[string]model.DTask
+	networks map[string]model.DSwarmNetwork
+}
+
+func newState(snapshot model.DSnapshot) *state {
+	s := &state{
+		nodes:    make(map[string]model.DNode),
+		services: make(map[string]model.DService),
+		tasks:    make(map[string]model.DTask),
+		networks: make(map[string]model.DSwarmNetwork),
+	}
+	for _, n := range snapshot.Nodes {
+		s.nodes[n.Id] = n
+	}
+	for _, svc := range snapshot.Services {
+		s.services[svc.Id] = svc
+	}
+	for _, t := range snapshot.Tasks {
+		s.tasks[t.Id] = t
+	}
+	for _, n := range snapshot.Networks {
+		s.networks[n.Id] = n
+	}
+	return s
+}
+
+// apply replays one event. Events of other types, and pending tasks that are not placed on any node, leave the
+// state as is.
+func (s *state) apply(event model.DHistoryEvent) error {
+	switch event.Type {
+	case "node":
+		e := model.DNodeEvent{}
+		if err := json.Unmarshal(event.Event, &e); err != nil {
+			return err
+		}
+		if e.Action == "stop" {
+			delete(s.nodes, e.Dnode.Id)
+		} else {
+			s.nodes[e.Dnode.Id] = e.Dnode
+		}
+	case "service":
+		e := model.DServiceEvent{}
+		if err := json.Unmarshal(event.Event, &e); err != nil {
+			return err
+		}
+		if e.Action == "stop" {
+			delete(s.services, e.DService.Id)
+		} else {
+			s.services[e.DService.Id] = e.DService
+		}
+	case "task":
+		// Task updates carry the task just like start and stop events do
+		e := model.DEvent{}
+		if err := json.Unmarshal(event.Event, &e); err != nil {
+			return err
+		}
+		switch e.Action {
+		case "stop":
+			delete(s.tasks, e.Dtask.Id)
+		case "start", "update":
+			s.tasks[e.Dtask.Id] = e.Dtask
+		}
+	case "network":
+		e := model.DNetworkEvent{}
+		if err := json.Unmarshal(event.Event, &e); err != nil {
+			return err
+		}
+		if e.Action == "stop" {
+			delete(s.networks, e.Dnetwork.Id)
+		} else {
+			s.networks[e.Dnetwork.Id] = e.Dnetwork
+		}
+	}
+	return nil
+}
+
+func (s *state) snapshot() model.DSnapshot {
+	snapshot := model.DSnapshot{
+		Nodes:    make([]model.DNode, 0, len(s.nodes)),
+		Services: make([]model.DService, 0, len(s.services)),
+		Tasks:    make([]model.DTask, 0, len(s.tasks)),
+		Networks: make([]model.DSwarmNetwork, 0, len(s.networks)),
+	}
+	for _, n := range s.nodes {
+		snapshot.Nodes = append(snapshot.Nodes, n)
+	}
+	for _, svc := range s.services {
+		snapshot.Services = append(snapshot.Services, svc)
+	}
+	for _, t := range s.tasks {
+		snapshot.Tasks = append(snapshot.Tasks, t)
+	}
+	for _, n := range s.networks {
+		snapshot.Networks = append(snapshot.Networks, n)
+	}
+	sort.Slice(snapshot.Nodes, func(i, j int) bool { return snapshot.Nodes[i].Id < snapshot.Nodes[j].Id })
+	sort.Slice(snapshot.Services, func(i, j int) bool { return snapshot.Services[i].Id < snapshot.Services[j].Id })
+	sort.Slice(snapshot.Tasks, func(i, j int) bool { return snapshot.Tasks[i].Id < snapshot.Tasks[j].Id })
+	sort.Slice(snapshot.Networks, func(i, j int) bool { return snapshot.Networks[i].Id < snapshot.Networks[j].Id })
+	return snapshot
+}
+
+// Snapshots lists the stored snapshots, the oldest first.
+func (s *Store) Snapshots() ([]model.DSnapshotInfo, error) {
+	result := make([]model.DSnapshotInfo, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).ForEach(func(k, _ []byte) error {
+			t := timeOf(k)
+			result = append(result, model.DSnapshotInfo{Id: strconv.FormatInt(t.UnixNano(), 10), Time: t})
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Snapshot returns a stored snapshot by its id, together with the time it was taken.
+func (s *Store) Snapshot(id string) (model.DSnapshot, time.Time, error) {
+	snapshot := model.DSnapshot{}
+	nanos, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return snapshot, time.Time{}, fmt.Errorf("invalid snapshot id %v", id)
+	}
+	t := time.Unix(0, nanos)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(snapshotsBucket).Get(key(t, 0))
+		if v == nil {
+			return fmt.Errorf("no snapshot %v", id)
+		}
+		return json.Unmarshal(v, &snapshot)
+	})
+	return snapshot, t, err
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStateAt(t *testing.T) {
+	store, now, closeStore := openStore(t)
+	defer closeStore()
+	start := *now
+
+	store.Record([]byte(`{"action":"start","type":"node","dnode":{"id":"n1","name":"worker-1"}}`))
+	*now = now.Add(time.Minute)
+	store.SaveSnapshot(DSnapshot{
+		Nodes:    []DNode{{Id: "n1", Name: "worker-1"}},
+		Services: []DService{{Id: "s1", Name: "web"}},
+		Tasks:    []DTask{{Id: "t1", ServiceId: "s1", NodeId: "n1", Status: "running"}},
+	})
+	*now = now.Add(time.Minute)
+	store.Record([]byte(`{"action":"update","type":"task","id":"t1","state":"failed","dtask":{"id":"t1","serviceId":"s1","nodeId":"n1","status":"failed"}}`))
+	store.Record([]byte(`{"action":"start","type":"task","dtask":{"id":"t2","serviceId":"s1","nodeId":"n1","status":"running"}}`))
+	store.Record([]byte(`{"action":"pending","type":"task","dtask":{"id":"t3","serviceId":"s1","status":"pending"}}`))
+	*now = now.Add(time.Minute)
+	store.Record([]byte(`{"action":"stop","type":"task","dtask":{"id":"t1","serviceId":"s1","nodeId":"n1"}}`))
+	store.Record([]byte(`{"action":"start","type":"network","dnetwork":{"id":"net1","name":"backend"}}`))
+
+	Convey("Given a snapshot and events around it", t, func() {
+		Convey("Before the first snapshot, the events are replayed from the start", func() {
+			state, err := store.StateAt(start.Add(time.Second * 30))
+			So(err, ShouldBeNil)
+			So(len(state.Nodes), ShouldEqual, 1)
+			So(len(state.Tasks), ShouldEqual, 0)
+		})
+		Convey("At the snapshot, the snapshot is returned", func() {
+			state, _ := store.StateAt(start.Add(time.Minute))
+			So(len(state.Tasks), ShouldEqual, 1)
+			So(state.Tasks[0].Status, ShouldEqual, "running")
+		})
+		Convey("Events after the snapshot are applied up to the given time", func() {
+			state, _ := store.StateAt(start.Add(time.Minute*2 + time.Second))
+			So(len(state.Tasks), ShouldEqual, 2)
+			So(state.Tasks[0].Status, ShouldEqual, "failed")
+			So(state.Tasks[1].Id, ShouldEqual, "t2")
+			So(len(state.Networks), ShouldEqual, 0)
+		})
+		Convey("Later events are all applied", func() {
+			state, _ := store.StateAt(start.Add(time.Hour))
+			So(len(state.Tasks), ShouldEqual, 1)
+			So(state.Tasks[0].Id, ShouldEqual, "t2")
+			So(state.Networks[0].Name, ShouldEqual, "backend")
+		})
+	})
+}
+
+func TestSnapshotsById(t *testing.T) {
+	store, now, closeStore := openStore(t)
+	defer closeStore()
+
+	store.SaveSnapshot(DSnapshot{Nodes: []DNode{{Id: "n1"}}})
+	*now = now.Add(time.Minute)
+	store.SaveSnapshot(DSnapshot{Nodes: []DNode{{Id: "n1"}, {Id: "n2"}}})
+
+	snapshots, err := store.Snapshots()
+
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(len(snapshots), ShouldEqual, 2)
+		So(snapshots[1].Time.Equal(*now), ShouldBeTrue)
+
+		snapshot, taken, err := store.Snapshot(snapshots[1].Id)
+		So(err, ShouldBeNil)
+		So(taken.Equal(*now), ShouldBeTrue)
+		So(len(snapshot.Nodes), ShouldEqual, 2)
+
+		_, _, err = store.Snapshot("42")
+		So(err, ShouldNotBeNil)
+	})
+}
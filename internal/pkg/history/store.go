@@ -0,0 +1,240 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	eventsBucket    = []byte("events")
+	snapshotsBucket = []byte("snapshots")
+)
+
+const defaultLimit = 1000
+
+// Store keeps published events and periodic snapshots of the model in a bbolt file. Both are keyed by the time
+// they were stored, so ranges of time are cheap to read and to prune.
+type Store struct {
+	db        *bolt.DB
+	retention time.Duration
+	now       func() time.Time
+}
+
+// Query selects events. Zero values match everything.
+type Query struct {
+	From    time.Time
+	To      time.Time
+	Entity  string // id or name of the entity
+	Service string // id of a service, matching the events of the service itself and of its tasks
+	Type    string
+	Action  string
+	Limit   int
+}
+
+// SnapshotSource is where periodic snapshots are taken from.
+type SnapshotSource interface {
+	Snapshot() model.DSnapshot
+}
+
+// Open opens or creates the store at path. Events and snapshots older than retention are pruned by Run.
+func Open(path string, retention time.Duration) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(eventsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, retention: retention, now: time.Now}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores a published event. Resource usage samples are left out, they are no changes of the model.
+func (s *Store) Record(data []byte) error {
+	return s.RecordBatch([][]byte{data})
+}
+
+// RecordBatch stores published events in one transaction, in the order given. Resource usage samples are left out.
+func (s *Store) RecordBatch(batch [][]byte) error {
+	now := s.now()
+	values := make([][]byte, 0, len(batch))
+	for _, data := range batch {
+		event := model.DHistoryEvent{Time: now, Event: json.RawMessage(data)}
+		if !Describe(data, &event) || event.Type == "stats" {
+			continue
+		}
+		value, err := json.Marshal(&event)
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		for _, value := range values {
+			seq, _ := b.NextSequence()
+			if err := b.Put(key(now, seq), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Events returns the events matching the query, the latest first.
+func (s *Store) Events(q Query) ([]model.DHistoryEvent, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	to := q.To
+	if to.IsZero() {
+		to = s.now()
+	}
+
+	result := make([]model.DHistoryEvent, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		// Seek lands on the first event after to, if any
+		k, v := c.Seek(key(to, ^uint64(0)))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && len(result) < limit; k, v = c.Prev() {
+			if !q.From.IsZero() && timeOf(k).Before(q.From) {
+				break
+			}
+			event := model.DHistoryEvent{}
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			if q.matches(event) {
+				result = append(result, event)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// SaveSnapshot stores the model as of now.
+func (s *Store) SaveSnapshot(snapshot model.DSnapshot) error {
+	value, err := json.Marshal(&snapshot)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).Put(key(s.now(), 0), value)
+	})
+}
+
+// Prune deletes the events and snapshots older than the retention.
+func (s *Store) Prune() error {
+	cutoff := key(s.now().Add(-s.retention), 0)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{eventsBucket, snapshotsBucket} {
+			c := tx.Bucket(name).Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Run saves a snapshot of the source and prunes the store at once and every interval. The first snapshot keeps
+// the model as found at startup, which is published without events.
+func (s *Store) Run(source SnapshotSource, interval time.Duration) {
+	for {
+		if err := s.SaveSnapshot(source.Snapshot()); err != nil {
+			logrus.Warnf("problem saving snapshot: %v", err)
+		}
+		if err := s.Prune(); err != nil {
+			logrus.Warnf("problem pruning history: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (q Query) matches(event model.DHistoryEvent) bool {
+	if q.Type != "" && q.Type != event.Type {
+		return false
+	}
+	if q.Action != "" && q.Action != event.Action {
+		return false
+	}
+	if q.Entity != "" && q.Entity != event.Entity && q.Entity != event.Name {
+		return false
+	}
+	if q.Service != "" && q.Service != event.Service {
+		return false
+	}
+	return true
+}
+
+// key is the big endian time in nanoseconds followed by a sequence, keeping keys unique and sorted by time.
+func key(t time.Time, seq uint64) []byte {
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(k[8:], seq)
+	return k
+}
+
+func timeOf(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+}
+
+// Describe pulls the type, action and the entity out of a published event.
+func Describe(data []byte, event *model.DHistoryEvent) bool {
+	fields := make(map[string]json.RawMessage)
+	if json.Unmarshal(data, &fields) != nil {
+		return false
+	}
+	json.Unmarshal(fields["type"], &event.Type)
+	json.Unmarshal(fields["action"], &event.Action)
+
+	for _, payload := range []string{"dtask", "dservice", "dnode", "dnetwork", "dsecret", "dconfig", "dvolume", "dstack", "dedge", "djob"} {
+		raw, ok := fields[payload]
+		if !ok {
+			continue
+		}
+		entity := struct {
+			Id        string
+			Name      string
+			ServiceId string
+		}{}
+		json.Unmarshal(raw, &entity)
+		event.Entity, event.Name, event.Service = entity.Id, entity.Name, entity.ServiceId
+		if payload == "dstack" {
+			event.Entity = entity.Name
+		}
+		if payload == "dservice" {
+			event.Service = entity.Id
+		}
+		break
+	}
+	return true
+}
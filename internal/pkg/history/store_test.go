@@ -0,0 +1,110 @@
+package history
+
+import (
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T) (*Store, *time.Time, func()) {
+	dir, err := ioutil.TempDir("", "dvizz-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(filepath.Join(dir, "dvizz.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 6, 12, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	return store, &now, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRecordAndQueryEvents(t *testing.T) {
+	store, now, closeStore := openStore(t)
+	defer closeStore()
+
+	store.Record([]byte(`{"action":"start","type":"service","dservice":{"id":"s1","name":"web"}}`))
+	*now = now.Add(time.Minute)
+	store.Record([]byte(`{"action":"start","type":"task","dtask":{"id":"t1","name":"nginx.1","serviceId":"s1"}}`))
+	*now = now.Add(time.Minute)
+	store.Record([]byte(`{"action":"update","type":"stats","stats":{}}`))
+	store.Record([]byte(`{"action":"stop","type":"task","dtask":{"id":"t1","name":"nginx.1","serviceId":"s1"}}`))
+	*now = now.Add(time.Minute)
+	store.Record([]byte(`{"action":"start","type":"node","dnode":{"id":"n1","name":"worker-1"}}`))
+
+	Convey("Given a few recorded events", t, func() {
+		Convey("All are returned the latest first, leaving out stats", func() {
+			events, err := store.Events(Query{})
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 4)
+			So(events[0].Entity, ShouldEqual, "n1")
+			So(events[0].Name, ShouldEqual, "worker-1")
+			So(events[3].Type, ShouldEqual, "service")
+		})
+		Convey("Events of a service include those of its tasks", func() {
+			events, _ := store.Events(Query{Service: "s1"})
+			So(len(events), ShouldEqual, 3)
+		})
+		Convey("Events may be filtered by entity, type and action", func() {
+			events, _ := store.Events(Query{Entity: "nginx.1", Type: "task", Action: "stop"})
+			So(len(events), ShouldEqual, 1)
+			So(string(events[0].Event), ShouldContainSubstring, `"action":"stop"`)
+		})
+		Convey("Events may be limited to a time range", func() {
+			start := time.Date(2019, 6, 12, 10, 0, 30, 0, time.UTC)
+			events, _ := store.Events(Query{From: start, To: start.Add(time.Minute * 2)})
+			So(len(events), ShouldEqual, 2)
+			So(events[0].Action, ShouldEqual, "stop")
+		})
+		Convey("Only the latest events are returned beyond the limit", func() {
+			events, _ := store.Events(Query{Limit: 1})
+			So(len(events), ShouldEqual, 1)
+			So(events[0].Type, ShouldEqual, "node")
+		})
+	})
+}
+
+func TestRecordBatch(t *testing.T) {
+	store, _, closeStore := openStore(t)
+	defer closeStore()
+
+	err := store.RecordBatch([][]byte{
+		[]byte(`{"action":"start","type":"task","dtask":{"id":"t1","serviceId":"s1"}}`),
+		[]byte(`{"action":"update","type":"stats","stats":{}}`),
+		[]byte(`{"action":"stop","type":"task","dtask":{"id":"t1","serviceId":"s1"}}`),
+	})
+	events, _ := store.Events(Query{})
+
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(len(events), ShouldEqual, 2)
+		So(events[0].Action, ShouldEqual, "stop")
+		So(events[1].Action, ShouldEqual, "start")
+	})
+}
+
+func TestPrune(t *testing.T) {
+	store, now, closeStore := openStore(t)
+	defer closeStore()
+
+	store.Record([]byte(`{"action":"start","type":"node","dnode":{"id":"n1"}}`))
+	store.SaveSnapshot(DSnapshot{})
+	*now = now.Add(time.Minute * 90)
+	store.Record([]byte(`{"action":"start","type":"node","dnode":{"id":"n2"}}`))
+	err := store.Prune()
+	events, _ := store.Events(Query{})
+
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(len(events), ShouldEqual, 1)
+		So(events[0].Entity, ShouldEqual, "n2")
+	})
+}
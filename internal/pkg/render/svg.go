@@ -0,0 +1,204 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"html"
+	"io"
+	"math"
+)
+
+// Filter narrows down what is drawn. Empty fields match everything.
+type Filter struct {
+	Stack   string
+	Service string
+	Node    string
+}
+
+// Sizes, in pixels. Radii are those of the web UI at scale 1.
+const (
+	margin         = 20
+	serviceRadius  = 20
+	serviceRowY    = margin + serviceRadius + 20
+	nodeTop        = serviceRowY + serviceRadius + 80
+	nodeGap        = 40
+	nodeHeader     = 50
+	taskRadius     = 10
+	taskSpacing    = 30
+	tasksPerRow    = 6
+	nodeWidth      = tasksPerRow*taskSpacing + taskSpacing
+	legendHeight   = 40
+	legendSpacing  = 110
+	minCanvasWidth = 4 * legendSpacing
+)
+
+// Fill and stroke per task state, matching circle.container in dvizz.css.
+type style struct {
+	fill        string
+	stroke      string
+	strokeWidth float64
+}
+
+var taskStyles = map[string]style{
+	"starting": {fill: "#bfb", stroke: "#f33", strokeWidth: 2.5},
+	"running":  {fill: "#bfb", stroke: "#333", strokeWidth: 1.5},
+	"shutdown": {fill: "#eee", stroke: "#f33", strokeWidth: 2.5},
+}
+
+var defaultTaskStyle = style{fill: "#fff", stroke: "#333", strokeWidth: 1.5}
+
+type point struct {
+	x, y int
+}
+
+// SVG lays out the swarm nodes side by side with their tasks inside, and the services above them linked to their
+// tasks, writing the picture as a standalone SVG document.
+func SVG(w io.Writer, snapshot model.DSnapshot, filter Filter) error {
+	snapshot = apply(snapshot, filter)
+
+	tasksOf := make(map[string][]model.DTask)
+	for _, t := range snapshot.Tasks {
+		tasksOf[t.NodeId] = append(tasksOf[t.NodeId], t)
+	}
+
+	// Nodes in a row, as tall as the one with the most tasks
+	height := nodeHeader + taskSpacing
+	for _, n := range snapshot.Nodes {
+		if h := nodeHeight(len(tasksOf[n.Id])); h > height {
+			height = h
+		}
+	}
+	width := margin*2 + len(snapshot.Nodes)*nodeWidth
+	if len(snapshot.Nodes) > 1 {
+		width += (len(snapshot.Nodes) - 1) * nodeGap
+	}
+	if width < minCanvasWidth {
+		width = minCanvasWidth
+	}
+	canvasHeight := nodeTop + height + margin + legendHeight
+
+	taskAt := make(map[string]point)
+	for i, n := range snapshot.Nodes {
+		x := margin + i*(nodeWidth+nodeGap)
+		for j, t := range tasksOf[n.Id] {
+			taskAt[t.Id] = point{
+				x: x + taskSpacing + (j%tasksPerRow)*taskSpacing,
+				y: nodeTop + nodeHeader + taskRadius + (j/tasksPerRow)*taskSpacing,
+			}
+		}
+	}
+	serviceAt := make(map[string]point)
+	for i, s := range snapshot.Services {
+		serviceAt[s.Id] = point{x: margin + (2*i+1)*(width-2*margin)/(2*len(snapshot.Services)), y: serviceRowY}
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"10\">\n", width, canvasHeight, width, canvasHeight)
+	fmt.Fprintf(b, "  <rect width=\"%d\" height=\"%d\" fill=\"#fff\"/>\n", width, canvasHeight)
+
+	// Links first, so circles are drawn on top of them
+	for _, t := range snapshot.Tasks {
+		from, ok := serviceAt[t.ServiceId]
+		to, placed := taskAt[t.Id]
+		if ok && placed {
+			fmt.Fprintf(b, "  <line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"darkgrey\" stroke-width=\"1.5\"/>\n", from.x, from.y, to.x, to.y)
+		}
+	}
+
+	for i, n := range snapshot.Nodes {
+		x := margin + i*(nodeWidth+nodeGap)
+		fmt.Fprintf(b, "  <g>\n    <title>%v</title>\n", escape(n.Name+" ("+n.State+", "+n.Availability+")"))
+		fmt.Fprintf(b, "    <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"8\" fill=\"#0e90d2\" fill-opacity=\"0.15\" stroke=\"#0e90d2\" stroke-width=\"1.5\"/>\n", x, nodeTop, nodeWidth, height)
+		fmt.Fprintf(b, "    <text x=\"%d\" y=\"%d\" font-size=\"12\">%v</text>\n", x+10, nodeTop+18, escape(n.Name))
+		fmt.Fprintf(b, "    <text x=\"%d\" y=\"%d\" font-size=\"8\">CPUs: %v, Memory: %v</text>\n  </g>\n", x+10, nodeTop+32, escape(n.CPUs), escape(n.Memory))
+	}
+
+	for _, t := range snapshot.Tasks {
+		p, placed := taskAt[t.Id]
+		if !placed {
+			continue
+		}
+		s := taskStyle(t.Status)
+		fmt.Fprintf(b, "  <g>\n    <title>%v</title>\n", escape(t.Name+" ("+t.Status+")"))
+		fmt.Fprintf(b, "    <circle cx=\"%d\" cy=\"%d\" r=\"%d\" fill=\"%v\" stroke=\"%v\" stroke-width=\"%v\"/>\n  </g>\n", p.x, p.y, taskRadius, s.fill, s.stroke, s.strokeWidth)
+	}
+
+	for _, s := range snapshot.Services {
+		p := serviceAt[s.Id]
+		fmt.Fprintf(b, "  <g>\n    <title>%v</title>\n", escape(s.Name+" "+s.Image))
+		fmt.Fprintf(b, "    <circle cx=\"%d\" cy=\"%d\" r=\"%d\" fill=\"LightYellow\" stroke=\"#333\" stroke-width=\"1.5\"/>\n", p.x, p.y, serviceRadius)
+		fmt.Fprintf(b, "    <text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%v</text>\n  </g>\n", p.x, p.y-serviceRadius-6, escape(s.Name))
+	}
+
+	legendY := nodeTop + height + margin + legendHeight/2
+	for i, state := range []string{"running", "starting", "shutdown", "other"} {
+		s := taskStyle(state)
+		x := margin + taskRadius + i*legendSpacing
+		fmt.Fprintf(b, "  <circle cx=\"%d\" cy=\"%d\" r=\"%d\" fill=\"%v\" stroke=\"%v\" stroke-width=\"%v\"/>\n", x, legendY, taskRadius, s.fill, s.stroke, s.strokeWidth)
+		fmt.Fprintf(b, "  <text x=\"%d\" y=\"%d\">%v</text>\n", x+taskRadius+6, legendY+4, state)
+	}
+
+	fmt.Fprintln(b, "</svg>")
+	return b.Flush()
+}
+
+func nodeHeight(tasks int) int {
+	rows := int(math.Ceil(float64(tasks) / tasksPerRow))
+	if rows == 0 {
+		rows = 1
+	}
+	return nodeHeader + rows*taskSpacing
+}
+
+func taskStyle(state string) style {
+	if s, ok := taskStyles[state]; ok {
+		return s
+	}
+	return defaultTaskStyle
+}
+
+// apply drops the services, tasks and nodes not matching the filter. When filtering by stack or service, nodes
+// without any of their tasks are dropped too, and when filtering by node, services without tasks on it.
+func apply(snapshot model.DSnapshot, filter Filter) model.DSnapshot {
+	if filter.Stack == "" && filter.Service == "" && filter.Node == "" {
+		return snapshot
+	}
+	result := model.DSnapshot{Networks: snapshot.Networks}
+	nodes := make(map[string]bool)
+	for _, n := range snapshot.Nodes {
+		if filter.Node == "" || n.Id == filter.Node || n.Name == filter.Node {
+			nodes[n.Id] = true
+		}
+	}
+	services := make(map[string]bool)
+	for _, s := range snapshot.Services {
+		if (filter.Stack == "" || s.Stack == filter.Stack) && (filter.Service == "" || s.Id == filter.Service || s.Name == filter.Service) {
+			services[s.Id] = true
+		}
+	}
+
+	withTasks := make(map[string]bool)
+	for _, t := range snapshot.Tasks {
+		if services[t.ServiceId] && nodes[t.NodeId] {
+			result.Tasks = append(result.Tasks, t)
+			withTasks[t.NodeId] = true
+			withTasks[t.ServiceId] = true
+		}
+	}
+	for _, n := range snapshot.Nodes {
+		if nodes[n.Id] && (withTasks[n.Id] || (filter.Stack == "" && filter.Service == "")) {
+			result.Nodes = append(result.Nodes, n)
+		}
+	}
+	for _, s := range snapshot.Services {
+		if services[s.Id] && (withTasks[s.Id] || filter.Node == "") {
+			result.Services = append(result.Services, s)
+		}
+	}
+	return result
+}
+
+func escape(s string) string {
+	return html.EscapeString(s)
+}
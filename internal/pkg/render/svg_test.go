@@ -0,0 +1,88 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"strings"
+	"testing"
+)
+
+func buildSnapshot() DSnapshot {
+	return DSnapshot{
+		Nodes: []DNode{{Id: "n1", Name: "worker-1", CPUs: "4", Memory: "8.0 GB"}, {Id: "n2", Name: "worker-2"}},
+		Services: []DService{
+			{Id: "s1", Name: "shop_web", Stack: "shop"},
+			{Id: "s2", Name: "monitor<dev>"},
+		},
+		Tasks: []DTask{
+			{Id: "t1", Name: "nginx.1", ServiceId: "s1", NodeId: "n1", Status: "running"},
+			{Id: "t2", Name: "nginx.2", ServiceId: "s1", NodeId: "n2", Status: "starting"},
+			{Id: "t3", Name: "prom.1", ServiceId: "s2", NodeId: "n2", Status: "preparing"},
+		},
+	}
+}
+
+// countElements parses the document, failing on malformed XML, and counts the elements by name.
+func countElements(doc string) (map[string]int, error) {
+	counts := make(map[string]int)
+	decoder := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return counts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			counts[start.Name.Local]++
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := SVG(buf, buildSnapshot(), Filter{})
+	counts, parseErr := countElements(buf.String())
+
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(parseErr, ShouldBeNil)
+		So(counts["svg"], ShouldEqual, 1)
+		// Two nodes plus the background
+		So(counts["rect"], ShouldEqual, 3)
+		// Three tasks, two services and four legend entries
+		So(counts["circle"], ShouldEqual, 9)
+		So(counts["line"], ShouldEqual, 3)
+		So(buf.String(), ShouldContainSubstring, "monitor&lt;dev&gt;")
+		So(buf.String(), ShouldContainSubstring, `fill="#bfb" stroke="#f33"`)
+		So(buf.String(), ShouldContainSubstring, "CPUs: 4, Memory: 8.0 GB</text>")
+	})
+}
+
+func TestSVGFilteredByStack(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := SVG(buf, buildSnapshot(), Filter{Stack: "shop"})
+	counts, _ := countElements(buf.String())
+
+	Convey("Assert", t, func() {
+		So(err, ShouldBeNil)
+		So(counts["rect"], ShouldEqual, 3)
+		So(counts["circle"], ShouldEqual, 7)
+		So(buf.String(), ShouldNotContainSubstring, "monitor")
+	})
+}
+
+func TestApplyNodeFilter(t *testing.T) {
+	snapshot := apply(buildSnapshot(), Filter{Node: "worker-1"})
+
+	Convey("Assert", t, func() {
+		So(len(snapshot.Nodes), ShouldEqual, 1)
+		So(len(snapshot.Tasks), ShouldEqual, 1)
+		So(len(snapshot.Services), ShouldEqual, 1)
+		So(snapshot.Services[0].Id, ShouldEqual, "s1")
+	})
+}
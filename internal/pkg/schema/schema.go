@@ -0,0 +1,174 @@
+// Package schema describes the messages sent to subscribers as JSON Schema, generated from the model types.
+package schema
+
+import (
+	"encoding/json"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Message is one kind of message sent to subscribers of /start: its type, the actions it comes with and the
+// payload it carries.
+type Message struct {
+	Type    string
+	Actions []model.Action
+	Payload interface{} // a value of the payload type, nil if there is no payload
+}
+
+var lifecycle = []model.Action{model.ActionStart, model.ActionStop, model.ActionUpdate}
+
+// Messages lists every message sent to subscribers of /start, except batches of them, including those sent to
+// subscribers scrubbing the history.
+var Messages = []Message{
+	{Type: "node", Actions: lifecycle, Payload: model.DNode{}},
+	{Type: "service", Actions: lifecycle, Payload: model.DService{}},
+	{Type: "task", Actions: append(lifecycle, model.ActionPending), Payload: model.DTask{}},
+	{Type: "network", Actions: lifecycle, Payload: model.DSwarmNetwork{}},
+	{Type: "secret", Actions: append(lifecycle, model.ActionUnused), Payload: model.DSecret{}},
+	{Type: "config", Actions: lifecycle, Payload: model.DConfig{}},
+	{Type: "volume", Actions: lifecycle, Payload: model.DVolume{}},
+	{Type: "stack", Actions: lifecycle, Payload: model.DStack{}},
+	{Type: "edge", Actions: lifecycle, Payload: model.DEdge{}},
+	{Type: "job", Actions: lifecycle, Payload: model.DJob{}},
+	{Type: "stats", Actions: []model.Action{model.ActionUpdate}, Payload: map[string]model.DTaskStats{}},
+	{Type: "ping", Actions: []model.Action{model.ActionPing}},
+	// Sent to subscribers scrubbing the history instead of the events above
+	{Type: "state", Actions: []model.Action{model.ActionUpdate}, Payload: model.DSnapshot{}},
+	{Type: "error", Actions: []model.Action{model.ActionError}, Payload: model.DError{}},
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// Document is the JSON Schema every message sent to subscribers of /start validates against. Each message is
+// also described on its own among the definitions, as message.{type}.
+func Document() map[string]interface{} {
+	g := &generator{definitions: make(map[string]interface{})}
+	messages := make([]interface{}, 0, len(Messages))
+	for _, m := range Messages {
+		var payload interface{}
+		if m.Payload != nil {
+			payload = g.of(reflect.TypeOf(m.Payload))
+		}
+		g.definitions["message."+m.Type] = envelope(m.Type, m.Actions, payload)
+		messages = append(messages, ref("message."+m.Type))
+	}
+	batch := map[string]interface{}{"type": "array", "items": map[string]interface{}{"oneOf": messages}}
+	g.definitions["message.batch"] = envelope("batch", []model.Action{model.ActionBatch}, batch)
+
+	return map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "dvizz events",
+		"description": "Messages sent to subscribers of /start, envelope version 2",
+		"definitions": g.definitions,
+		"oneOf":       append(messages, ref("message.batch")),
+	}
+}
+
+// envelope describes the envelope of a message of the given type.
+func envelope(typ string, actions []model.Action, payload interface{}) map[string]interface{} {
+	properties := map[string]interface{}{
+		"version":   map[string]interface{}{"const": model.EnvelopeVersion},
+		"stream":    map[string]interface{}{"type": "string"},
+		"seq":       map[string]interface{}{"type": "integer", "minimum": 1},
+		"timestamp": map[string]interface{}{"type": "string", "format": "date-time"},
+		"type":      map[string]interface{}{"const": typ},
+		"action":    map[string]interface{}{"enum": actions},
+	}
+	required := []string{"version", "timestamp", "type", "action"}
+	if payload != nil {
+		properties["payload"] = payload
+		required = append(required, "payload")
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/definitions/" + name}
+}
+
+// generator describes Go types the way encoding/json marshals them, collecting named structs as definitions.
+type generator struct {
+	definitions map[string]interface{}
+}
+
+func (g *generator) of(t reflect.Type) interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return map[string]interface{}{"anyOf": []interface{}{g.of(t.Elem()), map[string]interface{}{"type": "null"}}}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": g.of(t.Elem())}
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": g.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.definitions[t.Name()]; !ok {
+			g.definitions[t.Name()] = map[string]interface{}{} // placeholder for types referring to themselves
+			g.definitions[t.Name()] = g.object(t)
+		}
+		return ref(t.Name())
+	}
+	return map[string]interface{}{}
+}
+
+func (g *generator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	g.fields(t, properties, &required)
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+// fields adds the fields of a struct, and those of structs embedded in it, as encoding/json would.
+func (g *generator) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma+1:]
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.fields(field.Type, properties, required)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.of(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
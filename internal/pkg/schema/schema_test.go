@@ -0,0 +1,57 @@
+package schema
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Name string `json:"name"`
+}
+
+type outer struct {
+	Id       string            `json:"id"`
+	Count    int               `json:"count"`
+	Started  *time.Time        `json:"started,omitempty"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Inner    inner             `json:"inner"`
+	Skipped  string            `json:"-"`
+	internal string
+}
+
+func TestGenerator(t *testing.T) {
+	Convey("Given a struct", t, func() {
+		g := &generator{definitions: make(map[string]interface{})}
+		Convey("When described", func() {
+			result := g.of(reflect.TypeOf(outer{}))
+			Convey("Then it refers to a definition of its fields as encoding/json writes them", func() {
+				So(result, ShouldResemble, map[string]interface{}{"$ref": "#/definitions/outer"})
+				object := g.definitions["outer"].(map[string]interface{})
+				properties := object["properties"].(map[string]interface{})
+				So(len(properties), ShouldEqual, 6)
+				So(properties["count"], ShouldResemble, map[string]interface{}{"type": "integer"})
+				So(properties["tags"], ShouldResemble, map[string]interface{}{"type": []string{"array", "null"}, "items": map[string]interface{}{"type": "string"}})
+				So(properties["inner"], ShouldResemble, map[string]interface{}{"$ref": "#/definitions/inner"})
+				So(object["required"], ShouldResemble, []string{"id", "count", "tags", "labels", "inner"})
+				So(g.definitions, ShouldContainKey, "inner")
+			})
+		})
+	})
+}
+
+func TestDocumentDescribesEveryMessage(t *testing.T) {
+	Convey("Given the schema document", t, func() {
+		document := Document()
+		definitions := document["definitions"].(map[string]interface{})
+		Convey("Then every message and the batch are defined", func() {
+			for _, m := range Messages {
+				So(definitions, ShouldContainKey, "message."+m.Type)
+			}
+			So(definitions, ShouldContainKey, "message.batch")
+			So(len(document["oneOf"].([]interface{})), ShouldEqual, len(Messages)+1)
+		})
+	})
+}
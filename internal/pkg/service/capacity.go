@@ -0,0 +1,76 @@
+package service
+
+import (
+	"github.com/eriklupander/dvizz/internal/pkg/comms"
+	"github.com/eriklupander/dvizz/pkg/model"
+)
+
+// accountNodes sums up the reservations and limits of the tasks placed on each node, returning the nodes with
+// their usage filled in.
+func accountNodes(nodes []model.DNode, tasks []model.DTask) []model.DNode {
+	usage := make(map[string]*model.DNodeUsage)
+	for _, task := range tasks {
+		u, ok := usage[task.NodeId]
+		if !ok {
+			u = &model.DNodeUsage{}
+			usage[task.NodeId] = u
+		}
+		u.Reservations = add(u.Reservations, task.Reservations)
+		u.Limits = add(u.Limits, task.Limits)
+	}
+
+	result := make([]model.DNode, len(nodes))
+	for i, node := range nodes {
+		u := model.DNodeUsage{}
+		if found, ok := usage[node.Id]; ok {
+			u = *found
+		}
+		u.Allocatable = model.DResources{
+			NanoCPUs:    node.Capacity.NanoCPUs - u.Reservations.NanoCPUs,
+			MemoryBytes: node.Capacity.MemoryBytes - u.Reservations.MemoryBytes,
+		}
+		u.Overcommitted = u.Limits.NanoCPUs > node.Capacity.NanoCPUs || u.Limits.MemoryBytes > node.Capacity.MemoryBytes
+		node.Usage = u
+		result[i] = node
+	}
+	return result
+}
+
+// fits tells whether a task reserving r can be placed on the node.
+func fits(node model.DNode, r model.DResources) bool {
+	return node.State == "ready" && node.Availability == "active" &&
+		node.Usage.Allocatable.NanoCPUs >= r.NanoCPUs &&
+		node.Usage.Allocatable.MemoryBytes >= r.MemoryBytes
+}
+
+// Capacity reports the capacity and usage of every node. If serviceId is given, each line also tells whether
+// another replica of that service fits on the node.
+func (p *Publisher) Capacity(serviceId string) []model.DNodeCapacity {
+	p.lock.RLock()
+	nodes := accountNodes(p.lastNodes, p.lastTasks)
+	// From the spec, there may be no task to take them from
+	var reservations *model.DResources
+	for _, s := range p.lastServices {
+		if s.Id == serviceId {
+			reservations = &s.Reservations
+			break
+		}
+	}
+	p.lock.RUnlock()
+
+	report := make([]model.DNodeCapacity, len(nodes))
+	for i, node := range nodes {
+		report[i] = model.DNodeCapacity{NodeId: node.Id, Name: node.Name, Capacity: node.Capacity, Usage: node.Usage}
+		if reservations != nil {
+			f := fits(node, *reservations)
+			report[i].Fits = &f
+		}
+	}
+	return report
+}
+
+func add(a model.DResources, b model.DResources) model.DResources {
+	return model.DResources{NanoCPUs: a.NanoCPUs + b.NanoCPUs, MemoryBytes: a.MemoryBytes + b.MemoryBytes}
+}
+
+var _ comms.ModelProvider = (*Publisher)(nil)
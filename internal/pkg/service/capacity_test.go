@@ -0,0 +1,75 @@
+package service
+
+import (
+	"github.com/eriklupander/dvizz/cmd"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestAccountNodes(t *testing.T) {
+	nodes := []DNode{buildCapacityNode("node1", 4, 8000), buildCapacityNode("node2", 2, 4000)}
+	tasks := []DTask{
+		buildResourceTask("t1", "s1", "node1", DResources{NanoCPUs: 1e9, MemoryBytes: 1000}, DResources{NanoCPUs: 3e9, MemoryBytes: 2000}),
+		buildResourceTask("t2", "s1", "node1", DResources{NanoCPUs: 1e9, MemoryBytes: 1000}, DResources{NanoCPUs: 3e9, MemoryBytes: 2000}),
+	}
+
+	result := accountNodes(nodes, tasks)
+
+	Convey("Assert", t, func() {
+		So(result[0].Usage.Reservations, ShouldResemble, DResources{NanoCPUs: 2e9, MemoryBytes: 2000})
+		So(result[0].Usage.Limits, ShouldResemble, DResources{NanoCPUs: 6e9, MemoryBytes: 4000})
+		So(result[0].Usage.Allocatable, ShouldResemble, DResources{NanoCPUs: 2e9, MemoryBytes: 6000})
+		So(result[0].Usage.Overcommitted, ShouldBeTrue)
+		So(result[1].Usage.Allocatable, ShouldResemble, DResources{NanoCPUs: 2e9, MemoryBytes: 4000})
+		So(result[1].Usage.Overcommitted, ShouldBeFalse)
+	})
+}
+
+func TestCapacityTellsWhereAnotherReplicaFits(t *testing.T) {
+	p := NewPublisher(nil, cmd.DefaultConfiguration())
+	p.lastNodes = []DNode{buildCapacityNode("node1", 2, 8000), buildCapacityNode("node2", 4, 8000)}
+	p.lastTasks = []DTask{
+		buildResourceTask("t1", "s1", "node1", DResources{NanoCPUs: 2e9, MemoryBytes: 1000}, DResources{}),
+	}
+	p.lastServices = []DService{
+		{Id: "s1", Reservations: DResources{NanoCPUs: 2e9, MemoryBytes: 1000}},
+		{Id: "s2", Replicas: 0, Reservations: DResources{MemoryBytes: 1000}},
+	}
+
+	Convey("Given a service reserving 2 CPUs", t, func() {
+		report := p.Capacity("s1")
+		Convey("Then only the node with CPUs left fits another replica", func() {
+			So(len(report), ShouldEqual, 2)
+			So(*report[0].Fits, ShouldBeFalse)
+			So(*report[1].Fits, ShouldBeTrue)
+		})
+	})
+
+	Convey("Given a service without tasks", t, func() {
+		report := p.Capacity("s2")
+		Convey("Then fit is told from its spec", func() {
+			So(*report[0].Fits, ShouldBeTrue)
+			So(*report[1].Fits, ShouldBeTrue)
+		})
+	})
+
+	Convey("Given no service", t, func() {
+		report := p.Capacity("")
+		Convey("Then fit is left out", func() {
+			So(report[0].Fits, ShouldBeNil)
+		})
+	})
+}
+
+func buildCapacityNode(nodeId string, cpus int64, memory int64) DNode {
+	node := buildDNode(nodeId)
+	node.State = "ready"
+	node.Availability = "active"
+	node.Capacity = DResources{NanoCPUs: cpus * 1e9, MemoryBytes: memory}
+	return node
+}
+
+func buildResourceTask(taskId string, serviceId string, nodeId string, reservations DResources, limits DResources) DTask {
+	return DTask{Id: taskId, ServiceId: serviceId, NodeId: nodeId, Status: "running", Reservations: reservations, Limits: limits}
+}
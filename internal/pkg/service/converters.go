@@ -26,12 +26,18 @@ package service
 import (
 	"fmt"
 	"github.com/ahl5esoft/golang-underscore"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/swarm"
-	. "github.com/eriklupander/dvizz/internal/pkg/model"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	docker "github.com/fsouza/go-dockerclient"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// Label put on services and their containers by docker stack deploy.
+const stackNamespaceLabel = "com.docker.stack.namespace"
+
 func convNodes(nodes []swarm.Node) []DNode {
 	if nodes == nil || len(nodes) == 0 {
 		return make([]DNode, 0)
@@ -40,7 +46,49 @@ func convNodes(nodes []swarm.Node) []DNode {
 }
 
 func toDNode(node swarm.Node, _ int) DNode {
-	return DNode{Id: node.ID, State: string(node.Status.State), Name: node.Description.Hostname, CPUs: toCPU(node.Description.Resources.NanoCPUs), Memory: toMemory(node.Description.Resources.MemoryBytes)}
+	dnode := DNode{
+		Id:               node.ID,
+		State:            string(node.Status.State),
+		Name:             node.Description.Hostname,
+		CPUs:             toCPU(node.Description.Resources.NanoCPUs),
+		Memory:           toMemory(node.Description.Resources.MemoryBytes),
+		Role:             string(node.Spec.Role),
+		Availability:     string(node.Spec.Availability),
+		Addr:             node.Status.Addr,
+		EngineVersion:    node.Description.Engine.EngineVersion,
+		OS:               node.Description.Platform.OS,
+		Architecture:     node.Description.Platform.Architecture,
+		Labels:           make(map[string]string),
+		EngineLabels:     make(map[string]string),
+		Plugins:          make([]DPlugin, len(node.Description.Engine.Plugins)),
+		GenericResources: make([]DGenericResource, 0),
+		Capacity:         toDResources(&node.Description.Resources),
+	}
+	if node.ManagerStatus != nil {
+		dnode.Manager = &DManagerStatus{
+			Leader:       node.ManagerStatus.Leader,
+			Reachability: string(node.ManagerStatus.Reachability),
+			Addr:         node.ManagerStatus.Addr,
+		}
+	}
+	for k, v := range node.Spec.Labels {
+		dnode.Labels[k] = v
+	}
+	for k, v := range node.Description.Engine.Labels {
+		dnode.EngineLabels[k] = v
+	}
+	for idx, plugin := range node.Description.Engine.Plugins {
+		dnode.Plugins[idx] = DPlugin{Type: plugin.Type, Name: plugin.Name}
+	}
+	for _, gr := range node.Description.Resources.GenericResources {
+		if gr.NamedResourceSpec != nil {
+			dnode.GenericResources = append(dnode.GenericResources, DGenericResource{Kind: gr.NamedResourceSpec.Kind, Value: gr.NamedResourceSpec.Value})
+		}
+		if gr.DiscreteResourceSpec != nil {
+			dnode.GenericResources = append(dnode.GenericResources, DGenericResource{Kind: gr.DiscreteResourceSpec.Kind, Count: gr.DiscreteResourceSpec.Value})
+		}
+	}
+	return dnode
 }
 
 func convTasks(tasks []swarm.Task) []DTask {
@@ -53,25 +101,63 @@ func convTasks(tasks []swarm.Task) []DTask {
 		return task.NodeID != ""
 	}).Value(&dst)
 
-	u := underscore.Map(dst, func(task swarm.Task, _ int) DTask {
-		networks := make([]DNetwork, len(task.NetworksAttachments))
-		for idx, na := range task.NetworksAttachments {
-			networks[idx] = DNetwork{Id: na.Network.ID, Name: na.Network.Spec.Name}
-		}
+	u := underscore.Map(dst, toDTask)
+	dtasks, _ := u.([]DTask)
+	return dtasks
+}
 
-		return DTask{
-			Id:        task.ID,
-			Name:      sanitizeTaskName(task.Spec.ContainerSpec.Image) + "." + strconv.Itoa(task.Slot),
-			Status:    string(task.Status.State),
-			ServiceId: task.ServiceID,
-			NodeId:    task.NodeID,
-			Networks:  networks,
-		}
-	})
+// convPendingTasks converts the tasks not yet assigned to any node, typically since no node is suitable.
+func convPendingTasks(tasks []swarm.Task) []DTask {
+	dst := make([]swarm.Task, 0)
+	underscore.Chain2(tasks).Filter(func(task swarm.Task, _ int) bool {
+		return task.NodeID == ""
+	}).Value(&dst)
+	if len(dst) == 0 {
+		return make([]DTask, 0)
+	}
+
+	u := underscore.Map(dst, toDTask)
 	dtasks, _ := u.([]DTask)
 	return dtasks
 }
 
+func toDTask(task swarm.Task, _ int) DTask {
+	networks := make([]DNetwork, len(task.NetworksAttachments))
+	for idx, na := range task.NetworksAttachments {
+		networks[idx] = DNetwork{Id: na.Network.ID, Name: na.Network.Spec.Name, Addresses: make([]string, len(na.Addresses))}
+		copy(networks[idx].Addresses, na.Addresses)
+	}
+
+	dtask := DTask{
+		Id:           task.ID,
+		Status:       string(task.Status.State),
+		DesiredState: string(task.DesiredState),
+		Message:      task.Status.Message,
+		Err:          task.Status.Err,
+		Slot:         task.Slot,
+		ServiceId:    task.ServiceID,
+		NodeId:       task.NodeID,
+		CreatedAt:    task.CreatedAt,
+		UpdatedAt:    task.UpdatedAt,
+		Networks:     networks,
+	}
+	if task.Spec.ContainerSpec != nil {
+		dtask.Name = sanitizeTaskName(task.Spec.ContainerSpec.Image) + "." + strconv.Itoa(task.Slot)
+		dtask.Stack = task.Spec.ContainerSpec.Labels[stackNamespaceLabel]
+		_, dtask.Digest = splitDigest(task.Spec.ContainerSpec.Image)
+	}
+	if cs := task.Status.ContainerStatus; cs != nil {
+		dtask.ContainerId = cs.ContainerID
+		exitCode := cs.ExitCode
+		dtask.ExitCode = &exitCode
+	}
+	if task.Spec.Resources != nil {
+		dtask.Reservations = toDResources(task.Spec.Resources.Reservations)
+		dtask.Limits = toDResources(task.Spec.Resources.Limits)
+	}
+	return dtask
+}
+
 func sanitizeTaskName(name string) string {
 	index := strings.Index(name, ":latest")
 	if index > -1 {
@@ -90,13 +176,229 @@ func convServices(services []swarm.Service) []DService {
 	if services == nil || len(services) == 0 {
 		return make([]DService, 0)
 	}
-	u := underscore.Map(services, func(service swarm.Service, _ int) DService {
-		return DService{
-			Id:   service.ID,
-			Name: service.Spec.Name,
+	u := underscore.Map(services, toDService)
+	return u.([]DService)
+}
+
+func toDService(service swarm.Service, _ int) DService {
+	dservice := DService{
+		Id:     service.ID,
+		Name:   service.Spec.Name,
+		Ports:  make([]DPort, len(service.Endpoint.Ports)),
+		Labels: make(map[string]string),
+		Stack:  service.Spec.Labels[stackNamespaceLabel],
+	}
+	if service.Spec.TaskTemplate.ContainerSpec != nil {
+		dservice.Image, dservice.Digest = splitDigest(service.Spec.TaskTemplate.ContainerSpec.Image)
+	}
+	if service.Spec.Mode.Global != nil {
+		dservice.Mode = "global"
+	} else if service.Spec.Mode.Replicated != nil {
+		dservice.Mode = "replicated"
+		if service.Spec.Mode.Replicated.Replicas != nil {
+			dservice.Replicas = *service.Spec.Mode.Replicated.Replicas
+		}
+	}
+	for idx, port := range service.Endpoint.Ports {
+		dservice.Ports[idx] = DPort{
+			Protocol:      string(port.Protocol),
+			TargetPort:    port.TargetPort,
+			PublishedPort: port.PublishedPort,
+			PublishMode:   string(port.PublishMode),
+		}
+	}
+	for k, v := range service.Spec.Labels {
+		dservice.Labels[k] = v
+	}
+	if resources := service.Spec.TaskTemplate.Resources; resources != nil {
+		dservice.Reservations = toDResources(resources.Reservations)
+		dservice.Limits = toDResources(resources.Limits)
+	}
+	if service.UpdateStatus != nil {
+		dservice.UpdateStatus = &DUpdateStatus{
+			State:       string(service.UpdateStatus.State),
+			Message:     service.UpdateStatus.Message,
+			StartedAt:   service.UpdateStatus.StartedAt,
+			CompletedAt: service.UpdateStatus.CompletedAt,
+		}
+	}
+	return dservice
+}
+
+// splitDigest splits an image reference such as nginx:1.15@sha256:abc into nginx:1.15 and sha256:abc.
+func splitDigest(image string) (string, string) {
+	index := strings.Index(image, "@")
+	if index < 0 {
+		return image, ""
+	}
+	return image[:index], image[index+1:]
+}
+
+// convNetworks converts swarm scoped networks, attaching the ids of the services using them. The attachable and
+// ingress flags are those inspected from the network specs.
+func convNetworks(networks []docker.Network, flags map[string]networkFlags, services []swarm.Service) []DSwarmNetwork {
+	attached := make(map[string]map[string]bool)
+	for _, s := range services {
+		for _, na := range s.Spec.TaskTemplate.Networks {
+			addReference(attached, na.Target, s.ID)
+		}
+		// Virtual IPs also cover the ingress network of services publishing ports
+		for _, vip := range s.Endpoint.VirtualIPs {
+			addReference(attached, vip.NetworkID, s.ID)
+		}
+	}
+
+	result := make([]DSwarmNetwork, 0)
+	for _, n := range networks {
+		spec := flags[n.ID]
+		dnetwork := DSwarmNetwork{
+			Id:         n.ID,
+			Name:       n.Name,
+			Driver:     n.Driver,
+			Scope:      n.Scope,
+			Subnets:    make([]DSubnet, len(n.IPAM.Config)),
+			Attachable: spec.Attachable,
+			Ingress:    spec.Ingress || n.Name == "ingress",
+			Internal:   n.Internal,
+			Labels:     copyLabels(n.Labels),
+			Services:   referencesOf(attached, n.ID),
+		}
+		for idx, c := range n.IPAM.Config {
+			dnetwork.Subnets[idx] = DSubnet{Subnet: c.Subnet, Gateway: c.Gateway}
 		}
+		result = append(result, dnetwork)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
 	})
-	return u.([]DService)
+	return result
+}
+
+// convSecrets converts the secret metadata, attaching the ids of the services referencing each secret.
+func convSecrets(secrets []swarm.Secret, services []swarm.Service) []DSecret {
+	referenced := make(map[string]map[string]bool)
+	for _, s := range services {
+		if s.Spec.TaskTemplate.ContainerSpec == nil {
+			continue
+		}
+		for _, ref := range s.Spec.TaskTemplate.ContainerSpec.Secrets {
+			addReference(referenced, ref.SecretID, s.ID)
+		}
+	}
+
+	result := make([]DSecret, len(secrets))
+	for idx, secret := range secrets {
+		result[idx] = DSecret{
+			Id:        secret.ID,
+			Name:      secret.Spec.Name,
+			Labels:    copyLabels(secret.Spec.Labels),
+			CreatedAt: secret.CreatedAt,
+			UpdatedAt: secret.UpdatedAt,
+			Services:  referencesOf(referenced, secret.ID),
+		}
+		if secret.Spec.Driver != nil {
+			result[idx].Driver = secret.Spec.Driver.Name
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// convConfigs converts the config metadata, attaching the ids of the services referencing each config.
+func convConfigs(configs []swarm.Config, services []swarm.Service) []DConfig {
+	referenced := make(map[string]map[string]bool)
+	for _, s := range services {
+		if s.Spec.TaskTemplate.ContainerSpec == nil {
+			continue
+		}
+		for _, ref := range s.Spec.TaskTemplate.ContainerSpec.Configs {
+			addReference(referenced, ref.ConfigID, s.ID)
+		}
+	}
+
+	result := make([]DConfig, len(configs))
+	for idx, config := range configs {
+		result[idx] = DConfig{
+			Id:        config.ID,
+			Name:      config.Spec.Name,
+			Labels:    copyLabels(config.Spec.Labels),
+			CreatedAt: config.CreatedAt,
+			UpdatedAt: config.UpdatedAt,
+			Services:  referencesOf(referenced, config.ID),
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// convVolumes collects the named volumes and bind mounts of all services. Volumes are node local, so they are
+// derived from the service mounts rather than from the volume listing of the node we run on.
+func convVolumes(services []swarm.Service) []DVolume {
+	volumes := make(map[string]*DVolume)
+	referenced := make(map[string]map[string]bool)
+	for _, s := range services {
+		if s.Spec.TaskTemplate.ContainerSpec == nil {
+			continue
+		}
+		for _, m := range s.Spec.TaskTemplate.ContainerSpec.Mounts {
+			if (m.Type != mount.TypeVolume && m.Type != mount.TypeBind) || m.Source == "" {
+				continue
+			}
+			id := string(m.Type) + ":" + m.Source
+			if _, ok := volumes[id]; !ok {
+				volumes[id] = &DVolume{Id: id, Name: m.Source, Type: string(m.Type)}
+			}
+			if m.VolumeOptions != nil && m.VolumeOptions.DriverConfig != nil {
+				volumes[id].Driver = m.VolumeOptions.DriverConfig.Name
+			}
+			addReference(referenced, id, s.ID)
+		}
+	}
+
+	result := make([]DVolume, 0, len(volumes))
+	for id, volume := range volumes {
+		volume.Services = referencesOf(referenced, id)
+		result = append(result, *volume)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+func addReference(referenced map[string]map[string]bool, id string, serviceId string) {
+	if referenced[id] == nil {
+		referenced[id] = make(map[string]bool)
+	}
+	referenced[id][serviceId] = true
+}
+
+func referencesOf(referenced map[string]map[string]bool, id string) []string {
+	services := make([]string, 0, len(referenced[id]))
+	for serviceId := range referenced[id] {
+		services = append(services, serviceId)
+	}
+	sort.Strings(services)
+	return services
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+func toDResources(r *swarm.Resources) DResources {
+	if r == nil {
+		return DResources{}
+	}
+	return DResources{NanoCPUs: r.NanoCPUs, MemoryBytes: r.MemoryBytes}
 }
 
 func toCPU(c int64) string {
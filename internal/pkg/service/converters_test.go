@@ -1,7 +1,10 @@
 package service
 
 import (
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/swarm"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	docker "github.com/fsouza/go-dockerclient"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -80,3 +83,200 @@ func TestConvertServicesNil(t *testing.T) {
 		So(len(result), ShouldEqual, 0)
 	})
 }
+
+func TestConvertServices(t *testing.T) {
+	replicas := uint64(3)
+	service := swarm.Service{ID: "service-1"}
+	service.Spec.Name = "mystack_web"
+	service.Spec.Labels = map[string]string{"com.docker.stack.namespace": "mystack"}
+	service.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Image: "nginx:1.15@sha256:abc"}
+	service.Spec.TaskTemplate.Resources = &swarm.ResourceRequirements{Reservations: &swarm.Resources{NanoCPUs: 5e8}}
+	service.Spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &replicas}
+	service.Endpoint.Ports = []swarm.PortConfig{{Protocol: "tcp", TargetPort: 80, PublishedPort: 8080, PublishMode: "ingress"}}
+	service.UpdateStatus = &swarm.UpdateStatus{State: swarm.UpdateStateUpdating, Message: "update in progress"}
+
+	result := convServices([]swarm.Service{service})
+
+	Convey("Assert", t, func() {
+		So(len(result), ShouldEqual, 1)
+		So(result[0].Image, ShouldEqual, "nginx:1.15")
+		So(result[0].Digest, ShouldEqual, "sha256:abc")
+		So(result[0].Mode, ShouldEqual, "replicated")
+		So(result[0].Replicas, ShouldEqual, 3)
+		So(result[0].Stack, ShouldEqual, "mystack")
+		So(result[0].Ports[0].PublishedPort, ShouldEqual, 8080)
+		So(result[0].Reservations.NanoCPUs, ShouldEqual, 5e8)
+		So(result[0].UpdateStatus.State, ShouldEqual, "updating")
+	})
+}
+
+func TestConvertGlobalServiceWithoutDigest(t *testing.T) {
+	service := swarm.Service{ID: "service-1"}
+	service.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Image: "nginx:latest"}
+	service.Spec.Mode.Global = &swarm.GlobalService{}
+
+	result := convServices([]swarm.Service{service})
+
+	Convey("Assert", t, func() {
+		So(result[0].Image, ShouldEqual, "nginx:latest")
+		So(result[0].Digest, ShouldEqual, "")
+		So(result[0].Mode, ShouldEqual, "global")
+		So(result[0].UpdateStatus, ShouldBeNil)
+		So(result[0].Ports, ShouldNotBeNil)
+	})
+}
+
+func TestConvertTaskDetails(t *testing.T) {
+	task := swarm.Task{
+		ID:           "1",
+		NodeID:       "node-1",
+		ServiceID:    "service-1",
+		Slot:         3,
+		DesiredState: swarm.TaskStateShutdown,
+		Spec: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{Image: "image/name:1.0@sha256:abc"},
+		},
+		Status: swarm.TaskStatus{
+			State:           swarm.TaskStateFailed,
+			Message:         "started",
+			Err:             "task: non-zero exit (1)",
+			ContainerStatus: &swarm.ContainerStatus{ContainerID: "container-1", ExitCode: 1},
+		},
+		NetworksAttachments: []swarm.NetworkAttachment{{Addresses: []string{"10.0.0.5/24"}}},
+	}
+
+	result := convTasks([]swarm.Task{task})
+
+	Convey("Assert", t, func() {
+		So(result[0].DesiredState, ShouldEqual, "shutdown")
+		So(result[0].Err, ShouldEqual, "task: non-zero exit (1)")
+		So(result[0].Message, ShouldEqual, "started")
+		So(*result[0].ExitCode, ShouldEqual, 1)
+		So(result[0].ContainerId, ShouldEqual, "container-1")
+		So(result[0].Slot, ShouldEqual, 3)
+		So(result[0].Digest, ShouldEqual, "sha256:abc")
+		So(result[0].Networks[0].Addresses, ShouldResemble, []string{"10.0.0.5/24"})
+	})
+}
+
+func TestConvertPendingTasks(t *testing.T) {
+	placed := swarm.Task{ID: "1", NodeID: "node-1", Spec: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "name"}}}
+	pending := swarm.Task{
+		ID:     "2",
+		Spec:   swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "name"}},
+		Status: swarm.TaskStatus{State: swarm.TaskStatePending, Err: "no suitable node (insufficient resources on 3 nodes)"},
+	}
+
+	result := convPendingTasks([]swarm.Task{placed, pending})
+
+	Convey("Assert", t, func() {
+		So(len(result), ShouldEqual, 1)
+		So(result[0].Id, ShouldEqual, "2")
+		So(result[0].Err, ShouldStartWith, "no suitable node")
+		So(result[0].ExitCode, ShouldBeNil)
+	})
+}
+
+func TestConvertNodeDetails(t *testing.T) {
+	node := swarm.Node{ID: "id1"}
+	node.Spec.Role = swarm.NodeRoleManager
+	node.Spec.Availability = swarm.NodeAvailabilityDrain
+	node.Spec.Labels = map[string]string{"zone": "a"}
+	node.Status.Addr = "10.0.0.1"
+	node.ManagerStatus = &swarm.ManagerStatus{Leader: true, Reachability: swarm.ReachabilityReachable, Addr: "10.0.0.1:2377"}
+	node.Description.Platform = swarm.Platform{OS: "linux", Architecture: "x86_64"}
+	node.Description.Engine = swarm.EngineDescription{
+		EngineVersion: "18.09.2",
+		Labels:        map[string]string{"storage": "ssd"},
+		Plugins:       []swarm.PluginDescription{{Type: "Network", Name: "overlay"}},
+	}
+	node.Description.Resources.GenericResources = []swarm.GenericResource{
+		{DiscreteResourceSpec: &swarm.DiscreteGenericResource{Kind: "gpu", Value: 2}},
+	}
+
+	result := convNodes([]swarm.Node{node})
+
+	Convey("Assert", t, func() {
+		So(result[0].Role, ShouldEqual, "manager")
+		So(result[0].Availability, ShouldEqual, "drain")
+		So(result[0].Manager.Leader, ShouldBeTrue)
+		So(result[0].Manager.Reachability, ShouldEqual, "reachable")
+		So(result[0].Addr, ShouldEqual, "10.0.0.1")
+		So(result[0].EngineVersion, ShouldEqual, "18.09.2")
+		So(result[0].OS, ShouldEqual, "linux")
+		So(result[0].Architecture, ShouldEqual, "x86_64")
+		So(result[0].Labels["zone"], ShouldEqual, "a")
+		So(result[0].EngineLabels["storage"], ShouldEqual, "ssd")
+		So(result[0].Plugins[0].Name, ShouldEqual, "overlay")
+		So(result[0].GenericResources[0], ShouldResemble, DGenericResource{Kind: "gpu", Count: 2})
+	})
+}
+
+func TestConvertNetworks(t *testing.T) {
+	networks := []docker.Network{
+		{ID: "net-2", Name: "backend", Driver: "overlay", Scope: "swarm", IPAM: docker.IPAMOptions{Config: []docker.IPAMConfig{{Subnet: "10.0.1.0/24", Gateway: "10.0.1.1"}}}},
+		{ID: "net-1", Name: "ingress", Driver: "overlay", Scope: "swarm"},
+	}
+	services := []swarm.Service{{ID: "s2"}, {ID: "s1"}}
+	services[0].Spec.TaskTemplate.Networks = []swarm.NetworkAttachmentConfig{{Target: "net-2"}}
+	services[1].Spec.TaskTemplate.Networks = []swarm.NetworkAttachmentConfig{{Target: "net-2"}}
+	services[1].Endpoint.VirtualIPs = []swarm.EndpointVirtualIP{{NetworkID: "net-1"}}
+	flags := map[string]networkFlags{"net-2": {Attachable: true}, "net-1": {Ingress: true}}
+
+	result := convNetworks(networks, flags, services)
+
+	Convey("Assert", t, func() {
+		So(len(result), ShouldEqual, 2)
+		So(result[0].Name, ShouldEqual, "backend")
+		So(result[0].Attachable, ShouldBeTrue)
+		So(result[0].Ingress, ShouldBeFalse)
+		So(result[0].Subnets[0], ShouldResemble, DSubnet{Subnet: "10.0.1.0/24", Gateway: "10.0.1.1"})
+		So(result[0].Services, ShouldResemble, []string{"s1", "s2"})
+		So(result[1].Ingress, ShouldBeTrue)
+		So(result[1].Services, ShouldResemble, []string{"s1"})
+	})
+}
+
+func TestConvertSecretsAndConfigs(t *testing.T) {
+	secrets := []swarm.Secret{{ID: "sec-2", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "unused"}}}, {ID: "sec-1", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "db-password"}}}}
+	configs := []swarm.Config{{ID: "cfg-1", Spec: swarm.ConfigSpec{Annotations: swarm.Annotations{Name: "nginx.conf"}}}}
+	services := []swarm.Service{{ID: "s2"}, {ID: "s1"}, {ID: "s3"}}
+	services[0].Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Secrets: []*swarm.SecretReference{{SecretID: "sec-1"}}}
+	services[1].Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{
+		Secrets: []*swarm.SecretReference{{SecretID: "sec-1"}},
+		Configs: []*swarm.ConfigReference{{ConfigID: "cfg-1"}},
+	}
+
+	resultSecrets := convSecrets(secrets, services)
+	resultConfigs := convConfigs(configs, services)
+
+	Convey("Assert", t, func() {
+		So(len(resultSecrets), ShouldEqual, 2)
+		So(resultSecrets[0].Name, ShouldEqual, "db-password")
+		So(resultSecrets[0].Services, ShouldResemble, []string{"s1", "s2"})
+		So(resultSecrets[1].Services, ShouldBeEmpty)
+		So(resultConfigs[0].Services, ShouldResemble, []string{"s1"})
+	})
+}
+
+func TestConvertVolumes(t *testing.T) {
+	services := []swarm.Service{{ID: "s1"}, {ID: "s2"}}
+	services[0].Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Mounts: []mount.Mount{
+		{Type: mount.TypeVolume, Source: "data"},
+		{Type: mount.TypeBind, Source: "/var/run/docker.sock"},
+		{Type: mount.TypeTmpfs, Target: "/tmp"},
+	}}
+	services[1].Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Mounts: []mount.Mount{
+		{Type: mount.TypeVolume, Source: "data", VolumeOptions: &mount.VolumeOptions{DriverConfig: &mount.Driver{Name: "rexray"}}},
+	}}
+
+	result := convVolumes(services)
+
+	Convey("Assert", t, func() {
+		So(len(result), ShouldEqual, 2)
+		So(result[0].Id, ShouldEqual, "bind:/var/run/docker.sock")
+		So(result[1].Id, ShouldEqual, "volume:data")
+		So(result[1].Driver, ShouldEqual, "rexray")
+		So(result[1].Services, ShouldResemble, []string{"s1", "s2"})
+	})
+}
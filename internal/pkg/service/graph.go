@@ -0,0 +1,125 @@
+package service
+
+import (
+	"github.com/eriklupander/dvizz/internal/pkg/diff"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"reflect"
+	"sort"
+	"time"
+)
+
+/**
+ * Will derive the service graph from the last polled services and networks, at the network poll interval.
+ * Only the edges that changed are pushed, services are already pushed by PublishServices.
+ */
+func (p *Publisher) PublishGraph() {
+	// Derived once the services and networks were first polled, as the other listings are
+	p.Seeded()
+	p.lock.Lock()
+	p.lastGraph = convGraph(p.lastServices, p.lastNetworks)
+	p.lock.Unlock()
+	for {
+		time.Sleep(time.Second * time.Duration(p.config.NetworkPoll))
+
+		p.lock.RLock()
+		lastGraph := p.lastGraph
+		currentGraph := convGraph(p.lastServices, p.lastNetworks)
+		p.lock.RUnlock()
+
+		p.processEdgeListing(lastGraph.Edges, currentGraph.Edges)
+
+		p.lock.Lock()
+		p.lastGraph = currentGraph
+		p.lock.Unlock()
+	}
+}
+
+// Unit-testable
+func (p *Publisher) processEdgeListing(lastEdges []model.DEdge, currentEdges []model.DEdge) {
+	edges := diff.Compute(diff.Edges(lastEdges), diff.Edges(currentEdges), func(i, j int) bool {
+		return !reflect.DeepEqual(lastEdges[i], currentEdges[j])
+	})
+	for _, j := range edges.Added {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DEdgeEvent{Dedge: currentEdges[j], Action: model.ActionStart, Type: "edge"}))
+	}
+	for _, j := range edges.Changed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DEdgeEvent{Dedge: currentEdges[j], Action: model.ActionUpdate, Type: "edge"}))
+	}
+	for _, i := range edges.Removed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DEdgeEvent{Dedge: lastEdges[i], Action: model.ActionStop, Type: "edge"}))
+	}
+}
+
+// convGraph connects every pair of services attached to the same overlay network. The ingress network is left out,
+// as it routes published ports to services rather than letting services reach each other.
+func convGraph(services []model.DService, networks []model.DSwarmNetwork) model.DServiceGraph {
+	graph := model.DServiceGraph{Vertices: make([]model.DVertex, len(services)), Edges: make([]model.DEdge, 0)}
+	known := make(map[string]bool)
+	for idx, s := range services {
+		graph.Vertices[idx] = model.DVertex{Id: s.Id, Name: s.Name, Stack: s.Stack}
+		known[s.Id] = true
+	}
+	sort.Slice(graph.Vertices, func(i, j int) bool {
+		return graph.Vertices[i].Name < graph.Vertices[j].Name
+	})
+
+	edges := make(map[string]*model.DEdge)
+	for _, n := range networks {
+		if n.Ingress || n.Driver != "overlay" {
+			continue
+		}
+		for i, source := range n.Services {
+			for _, target := range n.Services[i+1:] {
+				if !known[source] || !known[target] {
+					continue
+				}
+				// Services are sorted, so source is always the lesser id
+				id := source + "-" + target
+				edge, ok := edges[id]
+				if !ok {
+					edge = &model.DEdge{Id: id, Source: source, Target: target, Networks: make([]model.DEdgeNetwork, 0)}
+					edges[id] = edge
+				}
+				edge.Networks = append(edge.Networks, model.DEdgeNetwork{Id: n.Id, Name: n.Name})
+			}
+		}
+	}
+
+	for _, edge := range edges {
+		sort.Slice(edge.Networks, func(i, j int) bool {
+			return edge.Networks[i].Name < edge.Networks[j].Name
+		})
+		graph.Edges = append(graph.Edges, *edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		return graph.Edges[i].Id < graph.Edges[j].Id
+	})
+	return graph
+}
+
+// Graph returns the service graph as last derived. If serviceId is given, only that service, the services it can
+// talk to and the edges between them and the service are returned.
+func (p *Publisher) Graph(serviceId string) model.DServiceGraph {
+	p.lock.RLock()
+	graph := p.lastGraph
+	p.lock.RUnlock()
+	if serviceId == "" {
+		return graph
+	}
+
+	neighbours := map[string]bool{serviceId: true}
+	result := model.DServiceGraph{Vertices: make([]model.DVertex, 0), Edges: make([]model.DEdge, 0)}
+	for _, e := range graph.Edges {
+		if e.Source == serviceId || e.Target == serviceId {
+			result.Edges = append(result.Edges, e)
+			neighbours[e.Source] = true
+			neighbours[e.Target] = true
+		}
+	}
+	for _, v := range graph.Vertices {
+		if neighbours[v.Id] {
+			result.Vertices = append(result.Vertices, v)
+		}
+	}
+	return result
+}
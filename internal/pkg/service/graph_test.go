@@ -0,0 +1,88 @@
+package service
+
+import (
+	"github.com/eriklupander/dvizz/cmd"
+	"github.com/eriklupander/dvizz/internal/pkg/comms/mock_comms"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestConvGraph(t *testing.T) {
+	services := []DService{{Id: "s1", Name: "web"}, {Id: "s2", Name: "api"}, {Id: "s3", Name: "db"}}
+	networks := []DSwarmNetwork{
+		{Id: "n1", Name: "frontend", Driver: "overlay", Services: []string{"s1", "s2"}},
+		{Id: "n2", Name: "backend", Driver: "overlay", Services: []string{"s1", "s2", "s3"}},
+		{Id: "n3", Name: "ingress", Driver: "overlay", Ingress: true, Services: []string{"s1", "s3"}},
+	}
+
+	graph := convGraph(services, networks)
+
+	Convey("Assert", t, func() {
+		So(len(graph.Vertices), ShouldEqual, 3)
+		So(graph.Vertices[0].Name, ShouldEqual, "api")
+		So(len(graph.Edges), ShouldEqual, 3)
+		So(graph.Edges[0].Id, ShouldEqual, "s1-s2")
+		So(graph.Edges[0].Networks, ShouldResemble, []DEdgeNetwork{{Id: "n2", Name: "backend"}, {Id: "n1", Name: "frontend"}})
+		So(graph.Edges[1].Id, ShouldEqual, "s1-s3")
+		So(graph.Edges[1].Networks, ShouldResemble, []DEdgeNetwork{{Id: "n2", Name: "backend"}})
+		So(graph.Edges[2].Id, ShouldEqual, "s2-s3")
+	})
+}
+
+func TestGraphOfOneService(t *testing.T) {
+	p := NewPublisher(nil, cmd.DefaultConfiguration())
+	p.lastGraph = convGraph(
+		[]DService{{Id: "s1", Name: "web"}, {Id: "s2", Name: "api"}, {Id: "s3", Name: "db"}},
+		[]DSwarmNetwork{
+			{Id: "n1", Name: "frontend", Driver: "overlay", Services: []string{"s1", "s2"}},
+			{Id: "n2", Name: "backend", Driver: "overlay", Services: []string{"s2", "s3"}},
+		})
+
+	graph := p.Graph("s3")
+
+	Convey("Assert", t, func() {
+		So(len(graph.Vertices), ShouldEqual, 2)
+		So(len(graph.Edges), ShouldEqual, 1)
+		So(graph.Edges[0].Source, ShouldEqual, "s2")
+	})
+}
+
+func TestGraphDerivedOnceSeeded(t *testing.T) {
+	p := NewPublisher(nil, cmd.DefaultConfiguration())
+	p.lastServices = []DService{{Id: "s1", Name: "web"}, {Id: "s2", Name: "api"}}
+	p.lastNetworks = []DSwarmNetwork{{Id: "n1", Name: "frontend", Driver: "overlay", Services: []string{"s1", "s2"}}}
+	go p.PublishGraph()
+
+	Convey("Given the services and networks were first polled", t, func() {
+		for i := 0; i < 4; i++ {
+			p.seeded.Done()
+		}
+		Convey("Then the graph is derived before the first network poll", func() {
+			deadline := time.Now().Add(time.Second)
+			for len(p.Graph("").Edges) == 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond * 10)
+			}
+			So(p.Graph("").Edges, ShouldHaveLength, 1)
+		})
+	})
+}
+
+func TestProcessEdgeListing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventServer := mock_comms.NewMockIEventServer(ctrl)
+	gomock.InOrder(
+		mockEventServer.EXPECT().AddEventToSendQueue(event("edge", "start", "s3-s4")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("edge", "update", "s1-s2")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("edge", "stop", "s1-s3")),
+	)
+
+	p := NewPublisher(mockEventServer, cmd.DefaultConfiguration())
+
+	lastEdges := []DEdge{{Id: "s1-s2", Networks: []DEdgeNetwork{{Id: "n1"}}}, {Id: "s1-s3"}, {Id: "s2-s3"}}
+	currentEdges := []DEdge{{Id: "s1-s2", Networks: []DEdgeNetwork{{Id: "n1"}, {Id: "n2"}}}, {Id: "s2-s3"}, {Id: "s3-s4"}}
+	p.processEdgeListing(lastEdges, currentEdges)
+}
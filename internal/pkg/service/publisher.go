@@ -2,25 +2,48 @@ package service
 
 import (
 	"encoding/json"
-	underscore "github.com/ahl5esoft/golang-underscore"
+	"fmt"
 	"github.com/eriklupander/dvizz/cmd"
 	"github.com/eriklupander/dvizz/internal/pkg/comms"
-	"github.com/eriklupander/dvizz/internal/pkg/model"
+	"github.com/eriklupander/dvizz/internal/pkg/diff"
+	"github.com/eriklupander/dvizz/pkg/model"
 	docker "github.com/fsouza/go-dockerclient"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
 	"time"
 )
 
 type Publisher struct {
-	filters     map[string][]string
-	lastNodes   []model.DNode
-	eventServer comms.IEventServer
-	config      *cmd.GlobalConfiguration
+	filters       map[string][]string
+	lock          sync.RWMutex // guards the last polled state read by the API
+	cycle         sync.Mutex   // serializes the service and task poll cycles so their events stay ordered
+	lastNodes     []model.DNode
+	lastServices  []model.DService
+	lastTasks     []model.DTask
+	lastPending   []model.DTask
+	lastNetworks  []model.DSwarmNetwork
+	lastResources resources
+	lastStacks    []model.DStack
+	lastGraph     model.DServiceGraph
+	eventServer   comms.IEventServer
+	config        *cmd.GlobalConfiguration
+	seeded        sync.WaitGroup // done once the nodes, services, tasks and networks were first polled
 }
 
 func NewPublisher(eventServer comms.IEventServer, config *cmd.GlobalConfiguration) *Publisher {
 	f := make(map[string][]string)
 	f["desired-state"] = []string{"running"}
-	return &Publisher{filters: f, eventServer: eventServer, config: config}
+	p := &Publisher{filters: f, eventServer: eventServer, config: config}
+	p.seeded.Add(4)
+	return p
+}
+
+// Seeded blocks until the nodes, services, tasks and networks were first polled.
+func (p *Publisher) Seeded() {
+	p.seeded.Wait()
 }
 
 /**
@@ -28,163 +51,334 @@ func NewPublisher(eventServer comms.IEventServer, config *cmd.GlobalConfiguratio
  */
 func (p *Publisher) PublishNodes(client *docker.Client) {
 	tmp, _ := client.ListNodes(docker.ListNodesOptions{})
-	p.lastNodes = convNodes(tmp)
+	p.lock.Lock()
+	p.lastNodes = accountNodes(convNodes(tmp), p.lastTasks)
+	p.lock.Unlock()
+	p.seeded.Done()
 	for {
 		time.Sleep(time.Second * time.Duration(p.config.NodePoll))
 		tmp2, _ := client.ListNodes(docker.ListNodesOptions{})
-		currentNodes := convNodes(tmp2)
+		p.lock.RLock()
+		currentNodes := accountNodes(convNodes(tmp2), p.lastTasks)
+		p.lock.RUnlock()
 		p.processNodeListing(currentNodes)
 	}
 }
 
 // Unit-testable
 func (p *Publisher) processNodeListing(currentNodes []model.DNode) {
+	lastNodes := p.lastNodes
+	nodes := diff.Compute(diff.Nodes(lastNodes), diff.Nodes(currentNodes), func(i, j int) bool {
+		return !reflect.DeepEqual(lastNodes[i], currentNodes[j])
+	})
+
+	// The model includes the changes before they are sent, so a snapshot always includes the events sent before it
+	p.lock.Lock()
+	p.lastNodes = currentNodes
+	p.lock.Unlock()
+
 	// Broadcasts stop events for nodes gone missing
-	for _, lastNode := range p.lastNodes {
-		isThere := underscore.Chain2(currentNodes).Any(func(other model.DObject, _ int) bool {
-			return other.Equals(lastNode)
-		})
-		if !isThere {
-			p.eventServer.AddEventToSendQueue(marshal(model.DNodeEvent{Action: "stop", Type: "node", Dnode: lastNode}))
-		}
+	for _, i := range nodes.Removed {
+		p.eventServer.AddEventToSendQueue(marshal(model.DNodeEvent{Action: model.ActionStop, Type: "node", Dnode: lastNodes[i]}))
 	}
 
 	// Broadcasts start events for nodes added
-	for _, currentNode := range currentNodes {
-		isThere := underscore.Chain2(p.lastNodes).Any(func(other model.DObject, _ int) bool {
-			return other.Equals(currentNode)
-		})
-		if !isThere {
-			p.eventServer.AddEventToSendQueue(marshal(model.DNodeEvent{Action: "start", Type: "node", Dnode: currentNode}))
-		}
+	for _, j := range nodes.Added {
+		p.eventServer.AddEventToSendQueue(marshal(model.DNodeEvent{Action: model.ActionStart, Type: "node", Dnode: currentNodes[j]}))
 	}
 
-	// Broadcast status updates
-	for _, currentNode := range currentNodes {
-		for _, lastNode := range p.lastNodes {
-			if currentNode.Id == lastNode.Id && currentNode.State != lastNode.State {
-				p.eventServer.AddEventToSendQueue(marshal(model.DNodeEvent{Action: "update", Type: "node", Dnode: currentNode}))
-			}
-		}
+	// Broadcast updates of state, availability, role, labels, usage or any other node property
+	for _, j := range nodes.Changed {
+		p.eventServer.AddEventToSendQueue(marshal(model.DNodeEvent{Action: model.ActionUpdate, Type: "node", Dnode: currentNodes[j]}))
 	}
-
-	p.lastNodes = currentNodes
 }
 
 /**
- * Will poll for Swarm service changes every second.
+ * Will poll for Swarm service changes. Tasks are listed in the same cycle, so the events of services and their
+ * tasks are delivered in order.
  */
 func (p *Publisher) PublishServices(client *docker.Client) {
 	services, _ := client.ListServices(docker.ListServicesOptions{})
-	lastServices := convServices(services)
+	p.cycle.Lock()
+	p.lock.Lock()
+	p.lastServices = convServices(services)
+	p.lock.Unlock()
+	p.cycle.Unlock()
+	p.seeded.Done()
 	for {
 		time.Sleep(time.Second * time.Duration(p.config.ServicePoll))
 
 		tmp, _ := client.ListServices(docker.ListServicesOptions{})
-
-		currentServices := convServices(tmp)
-
-		// First, check if there are any items in lastTasks NOT present in currentTasks. Keep those in temp list
-		toDelete := []model.DService{}
-		for _, lastService := range lastServices {
-			isThere := underscore.Chain2(currentServices).Any(func(other model.DObject, _ int) bool {
-				return other.Equals(lastService)
-			})
-			if !isThere {
-				toDelete = append(toDelete, lastService)
-			}
-		}
-
-		// Then, perform the opposite and populate the toAdd list
-		toAdd := []model.DService{}
-		for _, currentService := range currentServices {
-			isThere := underscore.Chain2(lastServices).Any(func(other model.DObject, _ int) bool {
-				return other.Equals(currentService)
-			})
-			if !isThere {
-				toAdd = append(toAdd, currentService)
-			}
-		}
-
-		// Finally, serialize to JSON and push as events
-		go underscore.Chain2(toAdd).Each(func(item model.DService, _ int) {
-			p.eventServer.AddEventToSendQueue(marshal(&model.DServiceEvent{DService: item, Action: "start", Type: "service"}))
-		})
-		go underscore.Chain2(toDelete).Each(func(item model.DService, _ int) {
-			p.eventServer.AddEventToSendQueue(marshal(&model.DServiceEvent{DService: item, Action: "stop", Type: "service"}))
-		})
-
-		lastServices = currentServices // Assign current as last for next iteration.
+		tasks, _ := client.ListTasks(docker.ListTasksOptions{Filters: p.filters})
+		p.processServiceCycle(convServices(tmp), convTasks(tasks), convPendingTasks(tasks))
 	}
 }
 
 /** Polls for task changes once per second */
 func (p *Publisher) PublishTasks(client *docker.Client) {
 	tasks, _ := client.ListTasks(docker.ListTasksOptions{Filters: p.filters})
-	lastTasks := convTasks(tasks)
+	p.cycle.Lock()
+	p.lock.Lock()
+	p.lastTasks = convTasks(tasks)
+	p.lastPending = convPendingTasks(tasks)
+	p.lock.Unlock()
+	p.cycle.Unlock()
+	p.seeded.Done()
 	for {
 		time.Sleep(time.Second * time.Duration(p.config.TaskPoll))
 
 		tmp, _ := client.ListTasks(docker.ListTasksOptions{Filters: p.filters})
+		p.processTaskCycle(convTasks(tmp), convPendingTasks(tmp))
+	}
+}
+
+// processServiceCycle publishes the changes of a service poll, along with the tasks listed with it. A service no
+// longer listed is only stopped once none of its tasks remain, so that their stops go out first.
+//
+// Unit-testable
+func (p *Publisher) processServiceCycle(currentServices []model.DService, currentTasks []model.DTask, currentPending []model.DTask) {
+	p.cycle.Lock()
+	defer p.cycle.Unlock()
 
-		currentTasks := convTasks(tmp)
+	p.lock.RLock()
+	lastServices := p.lastServices
+	p.lock.RUnlock()
 
-		// First, check if there are any items in lastTasks NOT present in currentTasks. Keep those in temp list
-		toDelete := []model.DTask{}
-		for _, lastTask := range lastTasks {
-			if !contains(currentTasks, lastTask) {
-				toDelete = append(toDelete, lastTask)
-			}
+	// Any change of a service, such as a new image, scaling or update progress, is sent as an update
+	services := diff.Compute(diff.Services(lastServices), diff.Services(currentServices), func(i, j int) bool {
+		return !reflect.DeepEqual(lastServices[i], currentServices[j])
+	})
+	startedServices := make([]model.DService, 0, len(services.Added))
+	for _, j := range services.Added {
+		startedServices = append(startedServices, currentServices[j])
+	}
+	updatedServices := make([]model.DService, 0, len(services.Changed))
+	for _, j := range services.Changed {
+		updatedServices = append(updatedServices, currentServices[j])
+	}
+
+	remaining := make(map[string]bool)
+	for _, t := range currentTasks {
+		remaining[t.ServiceId] = true
+	}
+	for _, t := range currentPending {
+		remaining[t.ServiceId] = true
+	}
+	stopped := make([]model.DService, 0, len(services.Removed))
+	for _, i := range services.Removed {
+		if s := lastServices[i]; remaining[s.Id] {
+			currentServices = append(currentServices, s)
+		} else {
+			stopped = append(stopped, s)
 		}
+	}
+
+	p.publishCycle(startedServices, updatedServices, stopped, currentServices, currentTasks, currentPending)
+}
+
+// processTaskCycle publishes the changes of a task poll. Tasks of services not yet announced are held back until the
+// next service poll.
+//
+// Unit-testable
+func (p *Publisher) processTaskCycle(currentTasks []model.DTask, currentPending []model.DTask) {
+	p.cycle.Lock()
+	defer p.cycle.Unlock()
+
+	p.lock.RLock()
+	lastServices, lastTasks, lastPending := p.lastServices, p.lastTasks, p.lastPending
+	p.lock.RUnlock()
+
+	currentTasks = announced(currentTasks, lastServices, lastTasks)
+	currentPending = announced(currentPending, lastServices, lastPending)
+	p.publishCycle(nil, nil, nil, lastServices, currentTasks, currentPending)
+}
+
+// publishCycle publishes the changes of one poll cycle in a well-defined order: services started, tasks started,
+// updates, tasks stopped and services stopped. Cycles never overlap, so the events of one entity are delivered in
+// the order they happened. The caller holds the cycle lock.
+func (p *Publisher) publishCycle(startedServices []model.DService, updatedServices []model.DService, stoppedServices []model.DService, currentServices []model.DService, currentTasks []model.DTask, currentPending []model.DTask) {
+	p.lock.RLock()
+	lastTasks, lastPending := p.lastTasks, p.lastPending
+	p.lock.RUnlock()
+
+	tasks := diff.Compute(diff.Tasks(lastTasks), diff.Tasks(currentTasks), diff.TaskChanged(lastTasks, currentTasks))
 
-		// Then, perform the opposite and populate the toAdd list
-		toAdd := []model.DTask{}
-		for _, currentTask := range currentTasks {
-			if !contains(lastTasks, currentTask) {
-				toAdd = append(toAdd, currentTask)
-			}
+	// Tasks not yet placed on any node cannot be drawn, but why they are pending is worth telling.
+	pendingTasks := []model.DTask{}
+	for _, currentTask := range currentPending {
+		if !containsPending(lastPending, currentTask) {
+			pendingTasks = append(pendingTasks, currentTask)
 		}
+	}
+
+	// The model includes the changes before they are sent, so a snapshot always includes the events sent before it
+	p.lock.Lock()
+	p.lastServices = currentServices
+	p.lastTasks = currentTasks
+	p.lastPending = currentPending
+	p.lock.Unlock()
 
-		// We also want state updates propagated to GUI (desiredState != actual state)
-		// Do this by comparing id + state for all
-		for _, currentTask := range currentTasks {
-			for _, lastTask := range lastTasks {
-				if currentTask.Id == lastTask.Id && currentTask.Status != lastTask.Status {
-					// We have a status change for a task,
-					go func(currentTask model.DTask) {
-						// Wait about .5 second until sending status updates for state changes.
-						p.eventServer.AddEventToSendQueue(marshal(&model.DTaskStateUpdate{Id: currentTask.Id, State: currentTask.Status, Action: "update", Type: "task"}))
-					}(currentTask)
-				}
-			}
+	for _, item := range startedServices {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DServiceEvent{DService: item, Action: model.ActionStart, Type: "service"}))
+	}
+	for _, j := range tasks.Added {
+		item := currentTasks[j]
+		p.eventServer.AddEventToSendQueue(marshal(&model.DEvent{Dtask: item, Action: model.ActionStart, Type: "task"}))
+	}
+	for _, item := range updatedServices {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DServiceEvent{DService: item, Action: model.ActionUpdate, Type: "service"}))
+	}
+	// We also want state updates propagated to GUI (desiredState != actual state)
+	for _, j := range tasks.Changed {
+		item := currentTasks[j]
+		p.eventServer.AddEventToSendQueue(marshal(&model.DTaskStateUpdate{Id: item.Id, State: item.Status, Message: item.Message, Err: item.Err, Dtask: item, Action: model.ActionUpdate, Type: "task"}))
+	}
+	for _, item := range pendingTasks {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DEvent{Dtask: item, Action: model.ActionPending, Type: "task"}))
+	}
+	for _, i := range tasks.Removed {
+		item := lastTasks[i]
+		p.eventServer.AddEventToSendQueue(marshal(&model.DEvent{Dtask: item, Action: model.ActionStop, Type: "task"}))
+	}
+	for _, item := range stoppedServices {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DServiceEvent{DService: item, Action: model.ActionStop, Type: "service"}))
+	}
+}
+
+// announced drops the tasks of services not yet announced, unless the task itself already was.
+func announced(tasks []model.DTask, services []model.DService, last []model.DTask) []model.DTask {
+	known := make(map[string]bool)
+	for _, s := range services {
+		known[s.Id] = true
+	}
+	for _, t := range last {
+		known[t.Id] = true
+	}
+	result := make([]model.DTask, 0, len(tasks))
+	for _, t := range tasks {
+		if known[t.ServiceId] || known[t.Id] {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+/**
+ * Will poll for swarm scoped network changes, including which services are attached.
+ */
+func (p *Publisher) PublishNetworks(client *docker.Client) {
+	lastNetworks, err := listNetworks(client)
+	if err != nil {
+		logrus.Warnf("problem listing networks: %v", err)
+	}
+	p.lock.Lock()
+	p.lastNetworks = lastNetworks
+	p.lock.Unlock()
+	p.seeded.Done()
+	for {
+		time.Sleep(time.Second * time.Duration(p.config.NetworkPoll))
+
+		// A failed poll would look like every network was removed
+		currentNetworks, err := listNetworks(client)
+		if err != nil {
+			logrus.Warnf("problem listing networks: %v", err)
+			continue
 		}
+		p.processNetworkListing(lastNetworks, currentNetworks)
+		lastNetworks = currentNetworks // Assign current as last for next iteration.
+	}
+}
 
-		// Finally, serialize to JSON and push as events
+// Unit-testable
+func (p *Publisher) processNetworkListing(lastNetworks []model.DSwarmNetwork, currentNetworks []model.DSwarmNetwork) {
+	networks := diff.Compute(diff.Networks(lastNetworks), diff.Networks(currentNetworks), func(i, j int) bool {
+		return !reflect.DeepEqual(lastNetworks[i], currentNetworks[j])
+	})
 
-		go underscore.Chain2(toAdd).Each(func(item model.DTask, _ int) {
-			p.eventServer.AddEventToSendQueue(marshal(&model.DEvent{Dtask: item, Action: "start", Type: "task"}))
-		})
-		go underscore.Chain2(toDelete).Each(func(item model.DTask, _ int) {
-			p.eventServer.AddEventToSendQueue(marshal(&model.DEvent{Dtask: item, Action: "stop", Type: "task"}))
-		})
+	// The model includes the changes before they are sent, so a snapshot always includes the events sent before it
+	p.lock.Lock()
+	p.lastNetworks = currentNetworks
+	p.lock.Unlock()
 
-		lastTasks = currentTasks // Assign current as last for next iteration.
+	for _, j := range networks.Added {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DNetworkEvent{Dnetwork: currentNetworks[j], Action: model.ActionStart, Type: "network"}))
+	}
+	for _, j := range networks.Changed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DNetworkEvent{Dnetwork: currentNetworks[j], Action: model.ActionUpdate, Type: "network"}))
+	}
+	for _, i := range networks.Removed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DNetworkEvent{Dnetwork: lastNetworks[i], Action: model.ActionStop, Type: "network"}))
 	}
 }
 
-//func (p *Publisher) PublishNetworks(client *docker.Client) {
-//	networks, _ := client.ListNetworks()
-//
-//
-//}
+func listNetworks(client *docker.Client) ([]model.DSwarmNetwork, error) {
+	networks, err := client.FilteredListNetworks(docker.NetworkFilterOpts{"scope": {"swarm": true}})
+	if err != nil {
+		return nil, err
+	}
+	services, err := client.ListServices(docker.ListServicesOptions{})
+	if err != nil {
+		return nil, err
+	}
+	flags := make(map[string]networkFlags)
+	for _, n := range networks {
+		if flags[n.ID], err = inspectNetwork(client, n.ID); err != nil {
+			return nil, err
+		}
+	}
+	return convNetworks(networks, flags, services), nil
+}
+
+// networkFlags are the flags of a network spec left out of the networks of go-dockerclient.
+type networkFlags struct {
+	Attachable bool
+	Ingress    bool
+}
+
+// inspectNetwork reads the flags of a network from its spec, through the HTTP client of the Docker client.
+func inspectNetwork(client *docker.Client, id string) (networkFlags, error) {
+	flags := networkFlags{}
+	endpoint, err := url.Parse(client.Endpoint())
+	if err != nil {
+		return flags, err
+	}
+	base := "http://" + endpoint.Host
+	switch {
+	case endpoint.Scheme == "unix":
+		base = "http://unix.sock" // the transport dials the socket whatever the host
+	case client.TLSConfig != nil:
+		base = "https://" + endpoint.Host
+	}
+	resp, err := client.HTTPClient.Get(base + "/networks/" + url.PathEscape(id))
+	if err != nil {
+		return flags, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return flags, fmt.Errorf("cannot inspect network %v: %v", id, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&flags)
+	return flags, err
+}
+
+// Networks returns the swarm scoped networks as last polled.
+func (p *Publisher) Networks() []model.DSwarmNetwork {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.lastNetworks
+}
 
 func marshal(intf interface{}) []byte {
 	data, _ := json.Marshal(intf)
 	return data
 }
 
-func contains(arr []model.DTask, dstruct model.Identifier) bool {
-	return underscore.Chain2(arr).Any(func(other model.DObject, _ int) bool {
-		return other.Equals(dstruct)
-	})
+// containsPending tells whether the pending task was already reported with the same state and error.
+func containsPending(arr []model.DTask, task model.DTask) bool {
+	for _, other := range arr {
+		if other.Id == task.Id && other.Status == task.Status && other.Err == task.Err {
+			return true
+		}
+	}
+	return false
 }
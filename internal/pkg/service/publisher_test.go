@@ -1,12 +1,16 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/eriklupander/dvizz/cmd"
 	"github.com/eriklupander/dvizz/internal/pkg/comms/mock_comms"
-	. "github.com/eriklupander/dvizz/internal/pkg/model"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	docker "github.com/fsouza/go-dockerclient"
 	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -75,6 +79,283 @@ func TestProcessOneNodeRemovedTwoAdded(t *testing.T) {
 	})
 }
 
+func TestProcessNodeAvailabilityChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventServer := mock_comms.NewMockIEventServer(ctrl)
+	mockEventServer.EXPECT().AddEventToSendQueue(gomock.Any()).Times(1)
+
+	p := NewPublisher(mockEventServer, cmd.DefaultConfiguration())
+
+	Convey("Given", t, func() {
+		// Start state, start with two nodes.
+		p.lastNodes = buildDNodes([]string{"node1", "node2"})
+		Convey("When", func() {
+			nextNodes := buildDNodes([]string{"node1", "node2"})
+			nextNodes[1].Availability = "drain"
+			p.processNodeListing(nextNodes)
+			Convey("Then", func() {
+				So(p.lastNodes[1].Availability, ShouldEqual, "drain")
+			})
+		})
+	})
+}
+
+func TestProcessNetworkListing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventServer := mock_comms.NewMockIEventServer(ctrl)
+	gomock.InOrder(
+		mockEventServer.EXPECT().AddEventToSendQueue(event("network", "start", "net3")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("network", "update", "net1")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("network", "stop", "net2")),
+	)
+
+	p := NewPublisher(mockEventServer, cmd.DefaultConfiguration())
+
+	lastNetworks := []DSwarmNetwork{{Id: "net1", Services: []string{"s1"}}, {Id: "net2"}}
+	currentNetworks := []DSwarmNetwork{{Id: "net1", Services: []string{"s1", "s2"}}, {Id: "net3"}}
+	p.processNetworkListing(lastNetworks, currentNetworks)
+}
+
+func TestInspectNetwork(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/networks/net1" {
+			http.Error(w, "Not found", 404)
+			return
+		}
+		w.Write([]byte(`{"Name":"backend","Id":"net1","Attachable":true,"Ingress":false}`))
+	}))
+	defer httpServer.Close()
+	client, _ := docker.NewClient(httpServer.URL)
+
+	Convey("Assert", t, func() {
+		flags, err := inspectNetwork(client, "net1")
+		So(err, ShouldBeNil)
+		So(flags.Attachable, ShouldBeTrue)
+		So(flags.Ingress, ShouldBeFalse)
+
+		_, err = inspectNetwork(client, "net2")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestProcessResourceListingAlertsUnusedSecret(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventServer := mock_comms.NewMockIEventServer(ctrl)
+	// sec1 no longer used, sec3 added without being used, cfg1 removed and sec2 unchanged
+	gomock.InOrder(
+		mockEventServer.EXPECT().AddEventToSendQueue(event("secret", "start", "sec3")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("secret", "update", "sec1")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("secret", "unused", "sec3")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("secret", "unused", "sec1")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("config", "stop", "cfg1")),
+	)
+
+	p := NewPublisher(mockEventServer, cmd.DefaultConfiguration())
+
+	last := resources{
+		secrets: []DSecret{{Id: "sec1", Services: []string{"s1"}}, {Id: "sec2"}},
+		configs: []DConfig{{Id: "cfg1"}},
+	}
+	current := resources{secrets: []DSecret{{Id: "sec1"}, {Id: "sec2"}, {Id: "sec3"}}}
+	p.processResourceListing(last, current)
+}
+
+func TestProcessFirstResourceListingAlertsUnusedSecret(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventServer := mock_comms.NewMockIEventServer(ctrl)
+	// sec2 is already unused when dvizz starts, and stays so
+	mockEventServer.EXPECT().AddEventToSendQueue(event("secret", "unused", "sec2")).Times(1)
+
+	p := NewPublisher(mockEventServer, cmd.DefaultConfiguration())
+
+	first := resources{secrets: []DSecret{{Id: "sec1", Services: []string{"s1"}}, {Id: "sec2"}}}
+	p.processFirstResourceListing(first)
+	p.processResourceListing(first, first)
+}
+
+func TestProcessCycleDeliversEventsInOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventServer := mock_comms.NewMockIEventServer(ctrl)
+	gomock.InOrder(
+		mockEventServer.EXPECT().AddEventToSendQueue(event("service", "start", "s3")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("task", "start", "t3")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("service", "update", "s1")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("task", "update", "t1")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("task", "pending", "t4")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("task", "stop", "t2")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("service", "stop", "s2")),
+	)
+
+	p := NewPublisher(mockEventServer, cmd.DefaultConfiguration())
+
+	Convey("Given", t, func() {
+		p.lastServices = []DService{{Id: "s1", Replicas: 1}, {Id: "s2"}}
+		p.lastTasks = []DTask{{Id: "t1", ServiceId: "s1", Status: "starting"}, {Id: "t2", ServiceId: "s2", Status: "running"}}
+		Convey("When", func() {
+			services := []DService{{Id: "s1", Replicas: 2}, {Id: "s3"}}
+			tasks := []DTask{{Id: "t1", ServiceId: "s1", Status: "running"}, {Id: "t3", ServiceId: "s3", Status: "running"}}
+			pending := []DTask{{Id: "t4", ServiceId: "s1", Status: "pending", Err: "no suitable node"}}
+			p.processServiceCycle(services, tasks, pending)
+			Convey("Then", func() {
+				So(len(p.lastServices), ShouldEqual, 2)
+				So(len(p.lastTasks), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestProcessCycleHoldsBackTasksOfUnannouncedServices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventServer := mock_comms.NewMockIEventServer(ctrl)
+	gomock.InOrder(
+		mockEventServer.EXPECT().AddEventToSendQueue(event("task", "start", "t2")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("service", "start", "s2")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("task", "start", "t3")),
+	)
+
+	p := NewPublisher(mockEventServer, cmd.DefaultConfiguration())
+
+	Convey("Given", t, func() {
+		p.lastServices = []DService{{Id: "s1"}}
+		p.lastTasks = []DTask{{Id: "t1", ServiceId: "s1", Status: "running"}}
+		Convey("When tasks are polled before their service", func() {
+			tasks := []DTask{{Id: "t1", ServiceId: "s1", Status: "running"}, {Id: "t2", ServiceId: "s1", Status: "running"}, {Id: "t3", ServiceId: "s2", Status: "running"}}
+			p.processTaskCycle(tasks, nil)
+			So(len(p.lastTasks), ShouldEqual, 2)
+
+			Convey("Then the task is started after its service", func() {
+				p.processServiceCycle([]DService{{Id: "s1"}, {Id: "s2"}}, tasks, nil)
+				So(len(p.lastTasks), ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+func TestProcessCycleStopsServiceAfterItsTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEventServer := mock_comms.NewMockIEventServer(ctrl)
+	gomock.InOrder(
+		mockEventServer.EXPECT().AddEventToSendQueue(event("task", "stop", "t1")),
+		mockEventServer.EXPECT().AddEventToSendQueue(event("service", "stop", "s1")),
+	)
+
+	p := NewPublisher(mockEventServer, cmd.DefaultConfiguration())
+
+	Convey("Given", t, func() {
+		p.lastServices = []DService{{Id: "s1"}}
+		p.lastTasks = []DTask{{Id: "t1", ServiceId: "s1", Status: "running"}}
+		Convey("When the service is removed before its tasks", func() {
+			p.processServiceCycle([]DService{}, p.lastTasks, nil)
+			So(len(p.lastServices), ShouldEqual, 1)
+
+			Convey("Then the service is stopped once its tasks are", func() {
+				p.processTaskCycle([]DTask{}, nil)
+				p.processServiceCycle([]DService{}, []DTask{}, nil)
+				So(p.lastServices, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+// numberingServer numbers the events queued as the event server does, through a queue small enough to fill up.
+type numberingServer struct {
+	queue chan []byte
+}
+
+func (s *numberingServer) AddEventToSendQueue(data []byte) { s.queue <- data }
+func (s *numberingServer) InitializeEventSystem()          {}
+func (s *numberingServer) Close()                          {}
+
+func TestSnapshotIncludesEventsSent(t *testing.T) {
+	server := &numberingServer{queue: make(chan []byte, 2)}
+	p := NewPublisher(server, cmd.DefaultConfiguration())
+	services := make([]DService, 0)
+	tasks := make([]DTask, 0)
+	for i := 0; i < 10; i++ {
+		services = append(services, DService{Id: fmt.Sprintf("s%v", i)})
+		tasks = append(tasks, DTask{Id: fmt.Sprintf("t%v", i), ServiceId: fmt.Sprintf("s%v", i), Status: "running"})
+	}
+
+	// Like GET /api/snapshot, take a snapshot as each event is numbered, while the cycle is blocked on the queue
+	missing := make([]string, 0)
+	done := make(chan bool)
+	go func() {
+		for data := range server.queue {
+			snapshot := p.Snapshot()
+			present := make(map[string]bool)
+			for _, s := range snapshot.Services {
+				present[s.Id] = true
+			}
+			for _, t := range snapshot.Tasks {
+				present[t.Id] = true
+			}
+			if id := idOf(data); !present[id] {
+				missing = append(missing, id)
+			}
+		}
+		done <- true
+	}()
+	p.processServiceCycle(services, tasks, nil)
+	close(server.queue)
+	<-done
+
+	Convey("Assert", t, func() {
+		So(missing, ShouldBeEmpty)
+	})
+}
+
+// idOf returns the id of the entity of an event, whichever field holds an object with an id.
+func idOf(data []byte) string {
+	var e map[string]json.RawMessage
+	json.Unmarshal(data, &e)
+	for _, raw := range e {
+		entity := struct {
+			Id string `json:"id"`
+		}{}
+		if json.Unmarshal(raw, &entity) == nil && entity.Id != "" {
+			return entity.Id
+		}
+	}
+	return ""
+}
+
+// eventMatcher matches a published event by its type, action and entity id.
+type eventMatcher struct {
+	typ    string
+	action string
+	id     string
+}
+
+func event(typ string, action string, id string) gomock.Matcher {
+	return eventMatcher{typ: typ, action: action, id: id}
+}
+
+func (m eventMatcher) Matches(x interface{}) bool {
+	data, ok := x.([]byte)
+	if !ok {
+		return false
+	}
+	var e map[string]json.RawMessage
+	if json.Unmarshal(data, &e) != nil {
+		return false
+	}
+	var typ, action string
+	json.Unmarshal(e["type"], &typ)
+	json.Unmarshal(e["action"], &action)
+	return typ == m.typ && action == m.action && idOf(data) == m.id
+}
+
+func (m eventMatcher) String() string {
+	return fmt.Sprintf("%v %v of %v", m.typ, m.action, m.id)
+}
+
 func buildDNodes(ids []string) []DNode {
 	nodes := make([]DNode, 0)
 	fmt.Printf("Before iterating %v nodes.\n", len(nodes))
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"github.com/eriklupander/dvizz/internal/pkg/diff"
+	"github.com/eriklupander/dvizz/pkg/model"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"time"
+)
+
+// resources are the secrets, configs and volumes used by services, as of one poll.
+type resources struct {
+	secrets []model.DSecret
+	configs []model.DConfig
+	volumes []model.DVolume
+}
+
+/**
+ * Will poll for changes of secrets, configs and volumes and of which services use them.
+ */
+func (p *Publisher) PublishResources(client *docker.Client) {
+	last, err := listResources(client)
+	if err != nil {
+		logrus.Warnf("problem listing secrets, configs and volumes: %v", err)
+	}
+	p.setResources(last)
+	p.processFirstResourceListing(last)
+	for {
+		time.Sleep(time.Second * time.Duration(p.config.ResourcePoll))
+
+		// A failed poll would look like every secret went unused or was removed
+		current, err := listResources(client)
+		if err != nil {
+			logrus.Warnf("problem listing secrets, configs and volumes: %v", err)
+			continue
+		}
+		p.processResourceListing(last, current)
+
+		last = current // Assign current as last for next iteration.
+		p.setResources(current)
+	}
+}
+
+// Unit-testable
+func (p *Publisher) processResourceListing(last resources, current resources) {
+	secrets := diff.Compute(diff.Secrets(last.secrets), diff.Secrets(current.secrets), func(i, j int) bool {
+		return !reflect.DeepEqual(last.secrets[i], current.secrets[j])
+	})
+	for _, j := range secrets.Added {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DSecretEvent{Dsecret: current.secrets[j], Action: model.ActionStart, Type: "secret"}))
+	}
+	for _, j := range secrets.Changed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DSecretEvent{Dsecret: current.secrets[j], Action: model.ActionUpdate, Type: "secret"}))
+	}
+	for _, i := range secrets.Removed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DSecretEvent{Dsecret: last.secrets[i], Action: model.ActionStop, Type: "secret"}))
+	}
+
+	// Alerted when a secret goes unused, not on every listing
+	referenced := make(map[string]bool)
+	for _, s := range last.secrets {
+		referenced[s.Id] = len(s.Services) > 0
+	}
+	for _, j := range append(secrets.Added, secrets.Changed...) {
+		s := current.secrets[j]
+		if _, existed := referenced[s.Id]; len(s.Services) == 0 && (!existed || referenced[s.Id]) {
+			p.alertUnused(s)
+		}
+	}
+
+	configs := diff.Compute(diff.Configs(last.configs), diff.Configs(current.configs), func(i, j int) bool {
+		return !reflect.DeepEqual(last.configs[i], current.configs[j])
+	})
+	for _, j := range configs.Added {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DConfigEvent{Dconfig: current.configs[j], Action: model.ActionStart, Type: "config"}))
+	}
+	for _, j := range configs.Changed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DConfigEvent{Dconfig: current.configs[j], Action: model.ActionUpdate, Type: "config"}))
+	}
+	for _, i := range configs.Removed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DConfigEvent{Dconfig: last.configs[i], Action: model.ActionStop, Type: "config"}))
+	}
+
+	volumes := diff.Compute(diff.Volumes(last.volumes), diff.Volumes(current.volumes), func(i, j int) bool {
+		return !reflect.DeepEqual(last.volumes[i], current.volumes[j])
+	})
+	for _, j := range volumes.Added {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DVolumeEvent{Dvolume: current.volumes[j], Action: model.ActionStart, Type: "volume"}))
+	}
+	for _, j := range volumes.Changed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DVolumeEvent{Dvolume: current.volumes[j], Action: model.ActionUpdate, Type: "volume"}))
+	}
+	for _, i := range volumes.Removed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DVolumeEvent{Dvolume: last.volumes[i], Action: model.ActionStop, Type: "volume"}))
+	}
+}
+
+// Unit-testable. Later listings only alert the secrets that went unused, so those unused from the start are alerted
+// here.
+func (p *Publisher) processFirstResourceListing(current resources) {
+	for _, s := range current.secrets {
+		if len(s.Services) == 0 {
+			p.alertUnused(s)
+		}
+	}
+}
+
+// A secret nobody reads should probably be removed
+func (p *Publisher) alertUnused(s model.DSecret) {
+	logrus.Warnf("Secret %v is not referenced by any service", s.Name)
+	p.eventServer.AddEventToSendQueue(marshal(&model.DSecretEvent{Dsecret: s, Action: model.ActionUnused, Type: "secret"}))
+}
+
+func listResources(client *docker.Client) (resources, error) {
+	services, err := client.ListServices(docker.ListServicesOptions{})
+	if err != nil {
+		return resources{}, err
+	}
+	secrets, err := client.ListSecrets(docker.ListSecretsOptions{})
+	if err != nil {
+		return resources{}, err
+	}
+	configs, err := client.ListConfigs(docker.ListConfigsOptions{})
+	if err != nil {
+		return resources{}, err
+	}
+	return resources{
+		secrets: convSecrets(secrets, services),
+		configs: convConfigs(configs, services),
+		volumes: convVolumes(services),
+	}, nil
+}
+
+func (p *Publisher) setResources(r resources) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.lastResources = r
+}
+
+// Secrets returns the secret metadata as last polled.
+func (p *Publisher) Secrets() []model.DSecret {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.lastResources.secrets
+}
+
+// Configs returns the config metadata as last polled.
+func (p *Publisher) Configs() []model.DConfig {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.lastResources.configs
+}
+
+// Volumes returns the volumes and bind mounts of services as last polled.
+func (p *Publisher) Volumes() []model.DVolume {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.lastResources.volumes
+}
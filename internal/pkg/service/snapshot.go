@@ -0,0 +1,46 @@
+package service
+
+import (
+	"github.com/eriklupander/dvizz/pkg/model"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// Snapshot returns the nodes, services, tasks and networks as last polled.
+func (p *Publisher) Snapshot() model.DSnapshot {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return model.DSnapshot{
+		Nodes:    p.lastNodes,
+		Services: p.lastServices,
+		Tasks:    p.lastTasks,
+		Networks: p.lastNetworks,
+	}
+}
+
+// TakeSnapshot polls the swarm once, converting the listings the same way the publisher does. Used by commands
+// that have no publisher running.
+func TakeSnapshot(client *docker.Client) (model.DSnapshot, error) {
+	nodes, err := client.ListNodes(docker.ListNodesOptions{})
+	if err != nil {
+		return model.DSnapshot{}, err
+	}
+	services, err := client.ListServices(docker.ListServicesOptions{})
+	if err != nil {
+		return model.DSnapshot{}, err
+	}
+	tasks, err := client.ListTasks(docker.ListTasksOptions{Filters: map[string][]string{"desired-state": {"running"}}})
+	if err != nil {
+		return model.DSnapshot{}, err
+	}
+	networks, err := listNetworks(client)
+	if err != nil {
+		return model.DSnapshot{}, err
+	}
+	dtasks := convTasks(tasks)
+	return model.DSnapshot{
+		Nodes:    accountNodes(convNodes(nodes), dtasks),
+		Services: convServices(services),
+		Tasks:    dtasks,
+		Networks: networks,
+	}, nil
+}
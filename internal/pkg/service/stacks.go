@@ -0,0 +1,133 @@
+package service
+
+import (
+	"github.com/eriklupander/dvizz/internal/pkg/diff"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Health of a service or stack.
+const (
+	healthConverged = "converged"
+	healthDegraded  = "degraded"
+	healthFailing   = "failing"
+)
+
+/**
+ * Will derive stacks from the last polled services and tasks, at the service poll interval.
+ */
+func (p *Publisher) PublishStacks() {
+	for {
+		time.Sleep(time.Second * time.Duration(p.config.ServicePoll))
+
+		p.lock.RLock()
+		lastStacks := p.lastStacks
+		currentStacks := convStacks(p.lastServices, p.lastTasks)
+		p.lock.RUnlock()
+
+		p.processStackListing(lastStacks, currentStacks)
+
+		p.lock.Lock()
+		p.lastStacks = currentStacks
+		p.lock.Unlock()
+	}
+}
+
+// Unit-testable
+func (p *Publisher) processStackListing(lastStacks []model.DStack, currentStacks []model.DStack) {
+	stacks := diff.Compute(diff.Stacks(lastStacks), diff.Stacks(currentStacks), func(i, j int) bool {
+		return !reflect.DeepEqual(lastStacks[i], currentStacks[j])
+	})
+	for _, j := range stacks.Added {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DStackEvent{Dstack: currentStacks[j], Action: model.ActionStart, Type: "stack"}))
+	}
+	for _, j := range stacks.Changed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DStackEvent{Dstack: currentStacks[j], Action: model.ActionUpdate, Type: "stack"}))
+	}
+	for _, i := range stacks.Removed {
+		p.eventServer.AddEventToSendQueue(marshal(&model.DStackEvent{Dstack: lastStacks[i], Action: model.ActionStop, Type: "stack"}))
+	}
+}
+
+// convStacks groups the services carrying a stack namespace into stacks. A stack is as healthy as its least healthy
+// service.
+func convStacks(services []model.DService, tasks []model.DTask) []model.DStack {
+	replicas := Replicas(services, tasks)
+	stacks := make(map[string]*model.DStack)
+	for i, service := range services {
+		if service.Stack == "" {
+			continue
+		}
+		stack, ok := stacks[service.Stack]
+		if !ok {
+			stack = &model.DStack{Name: service.Stack, Health: healthConverged, Services: make([]model.DStackService, 0)}
+			stacks[service.Stack] = stack
+		}
+		s := replicas[i]
+		stack.Services = append(stack.Services, s)
+
+		if s.Health == healthFailing || (s.Health == healthDegraded && stack.Health == healthConverged) {
+			stack.Health = s.Health
+		}
+	}
+
+	result := make([]model.DStack, 0, len(stacks))
+	for _, stack := range stacks {
+		sort.Slice(stack.Services, func(i, j int) bool {
+			return stack.Services[i].Name < stack.Services[j].Name
+		})
+		result = append(result, *stack)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func serviceHealth(s model.DStackService, updateStatus *model.DUpdateStatus) string {
+	switch {
+	case s.Desired > 0 && s.Running == 0:
+		return healthFailing
+	case s.Running < s.Desired:
+		return healthDegraded
+	case updateStatus != nil && (updateStatus.State == "paused" || updateStatus.State == "rollback_paused"):
+		// All replicas run, but on a mix of the old and the new spec
+		return healthDegraded
+	}
+	return healthConverged
+}
+
+// Replicas tells how many replicas of each service are desired and how many run, in the order of the services. A
+// service is converged when all its desired replicas run and failing when none does.
+func Replicas(services []model.DService, tasks []model.DTask) []model.DStackService {
+	running := make(map[string]int)
+	placed := make(map[string]int)
+	for _, task := range tasks {
+		placed[task.ServiceId]++
+		if task.Status == "running" {
+			running[task.ServiceId]++
+		}
+	}
+
+	result := make([]model.DStackService, 0, len(services))
+	for _, service := range services {
+		// Global services want one task per eligible node, which is what the scheduler has placed
+		desired := placed[service.Id]
+		if service.Mode == "replicated" {
+			desired = int(service.Replicas)
+		}
+		s := model.DStackService{Id: service.Id, Name: service.Name, Desired: desired, Running: running[service.Id]}
+		s.Health = serviceHealth(s, service.UpdateStatus)
+		result = append(result, s)
+	}
+	return result
+}
+
+// Stacks returns the stacks as last derived.
+func (p *Publisher) Stacks() []model.DStack {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.lastStacks
+}
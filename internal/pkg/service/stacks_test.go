@@ -0,0 +1,60 @@
+package service
+
+import (
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestConvStacks(t *testing.T) {
+	services := []DService{
+		{Id: "s1", Name: "shop_web", Stack: "shop", Mode: "replicated", Replicas: 2},
+		{Id: "s2", Name: "shop_db", Stack: "shop", Mode: "replicated", Replicas: 1},
+		{Id: "s3", Name: "blog_web", Stack: "blog", Mode: "global"},
+		{Id: "s4", Name: "monitor", Mode: "replicated", Replicas: 1},
+	}
+	tasks := []DTask{
+		{Id: "t1", ServiceId: "s1", Status: "running"},
+		{Id: "t2", ServiceId: "s1", Status: "preparing"},
+		{Id: "t3", ServiceId: "s2", Status: "running"},
+		{Id: "t4", ServiceId: "s3", Status: "running"},
+		{Id: "t5", ServiceId: "s3", Status: "running"},
+		{Id: "t6", ServiceId: "s4", Status: "running"},
+	}
+
+	result := convStacks(services, tasks)
+
+	Convey("Assert", t, func() {
+		So(len(result), ShouldEqual, 2)
+		So(result[0].Name, ShouldEqual, "blog")
+		So(result[0].Health, ShouldEqual, "converged")
+		So(result[0].Services[0], ShouldResemble, DStackService{Id: "s3", Name: "blog_web", Desired: 2, Running: 2, Health: "converged"})
+		So(result[1].Name, ShouldEqual, "shop")
+		So(result[1].Health, ShouldEqual, "degraded")
+		So(result[1].Services[0].Name, ShouldEqual, "shop_db")
+		So(result[1].Services[1].Health, ShouldEqual, "degraded")
+	})
+}
+
+func TestConvStacksFailingServiceFailsStack(t *testing.T) {
+	services := []DService{
+		{Id: "s1", Name: "shop_web", Stack: "shop", Mode: "replicated", Replicas: 2},
+		{Id: "s2", Name: "shop_db", Stack: "shop", Mode: "replicated", Replicas: 1},
+	}
+	tasks := []DTask{{Id: "t1", ServiceId: "s1", Status: "running"}, {Id: "t2", ServiceId: "s2", Status: "failed"}}
+
+	result := convStacks(services, tasks)
+
+	Convey("Assert", t, func() {
+		So(result[0].Health, ShouldEqual, "failing")
+		So(result[0].Services[0].Health, ShouldEqual, "failing")
+	})
+}
+
+func TestServiceHealthDuringPausedUpdate(t *testing.T) {
+	s := DStackService{Desired: 2, Running: 2}
+	Convey("Assert", t, func() {
+		So(serviceHealth(s, nil), ShouldEqual, "converged")
+		So(serviceHealth(s, &DUpdateStatus{State: "paused"}), ShouldEqual, "degraded")
+	})
+}
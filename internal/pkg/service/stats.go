@@ -0,0 +1,201 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/eriklupander/dvizz/pkg/model"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Labels put on task containers by the swarm.
+const (
+	taskIdLabel = "com.docker.swarm.task.id"
+	nodeIdLabel = "com.docker.swarm.node.id"
+)
+
+const containerStatsTimeout = time.Second * 10
+
+// StatsCollector samples the resource usage of the task containers running on the local node.
+type StatsCollector struct {
+	client *docker.Client
+}
+
+func NewStatsCollector(client *docker.Client) *StatsCollector {
+	return &StatsCollector{client: client}
+}
+
+// LocalStats returns one sample per running task container on this node.
+func (s *StatsCollector) LocalStats() ([]model.DTaskStats, error) {
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{Filters: map[string][]string{"label": {taskIdLabel}}})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]model.DTaskStats, 0)
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, c := range containers {
+		wg.Add(1)
+		go func(c docker.APIContainers) {
+			defer wg.Done()
+			stats, err := s.containerStats(c.ID)
+			if err != nil {
+				logrus.Debugf("Could not get stats of container %v: %v", c.ID, err)
+				return
+			}
+			ts := toDTaskStats(stats)
+			ts.TaskId = c.Labels[taskIdLabel]
+			ts.NodeId = c.Labels[nodeIdLabel]
+			ts.ContainerId = c.ID
+
+			lock.Lock()
+			result = append(result, ts)
+			lock.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	return result, nil
+}
+
+func (s *StatsCollector) containerStats(id string) (*docker.Stats, error) {
+	statsC := make(chan *docker.Stats, 1)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.client.Stats(docker.StatsOptions{ID: id, Stats: statsC, Stream: false, Timeout: containerStatsTimeout})
+	}()
+	var last *docker.Stats
+	for stats := range statsC {
+		last = stats
+	}
+	if err := <-errC; err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, fmt.Errorf("no stats returned for container %v", id)
+	}
+	return last, nil
+}
+
+/**
+ * Will poll for task resource usage, on this node and through the agents on the other nodes.
+ */
+func (p *Publisher) PublishStats(client *docker.Client, collector *StatsCollector) {
+	httpClient := &http.Client{Timeout: containerStatsTimeout * 2}
+	for {
+		time.Sleep(time.Second * time.Duration(p.config.StatsPoll))
+
+		stats := make(map[string]model.DTaskStats)
+		local, err := collector.LocalStats()
+		if err != nil {
+			logrus.Warnf("problem collecting local stats: %v", err)
+		}
+		for _, ts := range local {
+			stats[ts.TaskId] = ts
+		}
+
+		if p.config.AgentPort > 0 {
+			for _, ts := range p.remoteStats(client, httpClient) {
+				stats[ts.TaskId] = ts
+			}
+		}
+
+		if len(stats) > 0 {
+			p.eventServer.AddEventToSendQueue(marshal(&model.DStatsEvent{Action: model.ActionUpdate, Type: "stats", Stats: stats}))
+		}
+	}
+}
+
+// remoteStats asks the agents on all other ready nodes for the stats of their tasks.
+func (p *Publisher) remoteStats(client *docker.Client, httpClient *http.Client) []model.DTaskStats {
+	info, err := client.Info()
+	if err != nil {
+		logrus.Warnf("problem getting local node: %v", err)
+		return nil
+	}
+	nodes, err := client.ListNodes(docker.ListNodesOptions{})
+	if err != nil {
+		logrus.Warnf("problem listing nodes: %v", err)
+		return nil
+	}
+
+	result := make([]model.DTaskStats, 0)
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, node := range nodes {
+		if node.ID == info.Swarm.NodeID || node.Status.State != "ready" || node.Status.Addr == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			stats, err := fetchAgentStats(httpClient, fmt.Sprintf("http://%v:%d/api/stats/local", addr, p.config.AgentPort))
+			if err != nil {
+				logrus.Debugf("Could not get stats from agent at %v: %v", addr, err)
+				return
+			}
+			lock.Lock()
+			result = append(result, stats...)
+			lock.Unlock()
+		}(node.Status.Addr)
+	}
+	wg.Wait()
+	return result
+}
+
+func fetchAgentStats(httpClient *http.Client, url string) ([]model.DTaskStats, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent responded %v", resp.Status)
+	}
+	stats := make([]model.DTaskStats, 0)
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return stats, err
+}
+
+func toDTaskStats(stats *docker.Stats) model.DTaskStats {
+	ts := model.DTaskStats{
+		CPUPercent:  cpuPercent(stats),
+		MemoryUsage: stats.MemoryStats.Usage,
+		MemoryLimit: stats.MemoryStats.Limit,
+		Read:        stats.Read,
+	}
+	// Same as docker stats, page cache is not counted as used memory
+	if stats.MemoryStats.Stats.Cache < ts.MemoryUsage {
+		ts.MemoryUsage -= stats.MemoryStats.Stats.Cache
+	}
+	for _, n := range stats.Networks {
+		ts.NetworkRx += n.RxBytes
+		ts.NetworkTx += n.TxBytes
+	}
+	for _, entry := range stats.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			ts.BlockRead += entry.Value
+		case "write":
+			ts.BlockWrite += entry.Value
+		}
+	}
+	return ts
+}
+
+func cpuPercent(stats *docker.Stats) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * cpus * 100.0
+}
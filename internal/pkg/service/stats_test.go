@@ -0,0 +1,50 @@
+package service
+
+import (
+	docker "github.com/fsouza/go-dockerclient"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestToDTaskStats(t *testing.T) {
+	stats := &docker.Stats{}
+	stats.CPUStats.CPUUsage.TotalUsage = 300
+	stats.CPUStats.SystemCPUUsage = 2000
+	stats.CPUStats.OnlineCPUs = 2
+	stats.PreCPUStats.CPUUsage.TotalUsage = 100
+	stats.PreCPUStats.SystemCPUUsage = 1000
+	stats.MemoryStats.Usage = 1000
+	stats.MemoryStats.Limit = 4000
+	stats.MemoryStats.Stats.Cache = 200
+	stats.Networks = map[string]docker.NetworkStats{
+		"eth0": {RxBytes: 10, TxBytes: 20},
+		"eth1": {RxBytes: 1, TxBytes: 2},
+	}
+	stats.BlkioStats.IOServiceBytesRecursive = []docker.BlkioStatsEntry{
+		{Op: "Read", Value: 5},
+		{Op: "Write", Value: 7},
+		{Op: "Total", Value: 12},
+	}
+
+	ts := toDTaskStats(stats)
+
+	Convey("Assert", t, func() {
+		So(ts.CPUPercent, ShouldAlmostEqual, 40.0)
+		So(ts.MemoryUsage, ShouldEqual, 800)
+		So(ts.MemoryLimit, ShouldEqual, 4000)
+		So(ts.NetworkRx, ShouldEqual, 11)
+		So(ts.NetworkTx, ShouldEqual, 22)
+		So(ts.BlockRead, ShouldEqual, 5)
+		So(ts.BlockWrite, ShouldEqual, 7)
+	})
+}
+
+func TestCPUPercentWithoutPreviousSample(t *testing.T) {
+	stats := &docker.Stats{}
+	stats.CPUStats.CPUUsage.TotalUsage = 300
+	stats.CPUStats.SystemCPUUsage = 2000
+
+	Convey("Assert", t, func() {
+		So(cpuPercent(stats), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,202 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/eriklupander/dvizz/internal/pkg/service"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ANSI colours, following those of the tasks in the browser
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	dim    = "\x1b[2m"
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+	blue   = "\x1b[34m"
+)
+
+// minEvents is how many lines the event log keeps however many nodes and services there are.
+const minEvents = 5
+
+// Entry is a line of the event log.
+type Entry struct {
+	Time   time.Time
+	Type   string
+	Action model.Action
+	Name   string
+}
+
+// Render draws the nodes with their tasks, the services with their replicas and the latest events to fit a terminal
+// of the given size. Nodes and services that do not fit are left out, as are the oldest events.
+func Render(w io.Writer, snapshot model.DSnapshot, events []Entry, now time.Time, width int, height int) {
+	if height < 3 {
+		height = 3
+	}
+	top := &screen{width: width}
+	top.print(bold, "dvizz")
+	top.print("", fmt.Sprintf("  %v nodes  %v services  %v tasks  %v", len(snapshot.Nodes), len(snapshot.Services), len(snapshot.Tasks), now.Format("15:04:05")))
+	top.newline()
+	top.newline()
+	nodes(top, snapshot)
+	top.newline()
+	services(top, snapshot)
+	top.newline()
+
+	// The event log gets what is left, but at least a few lines
+	room := height - len(top.lines)
+	if room < minEvents {
+		room = minEvents
+	}
+	if room > height {
+		room = height
+	}
+	lines := top.lines
+	if len(lines) > height-room {
+		lines = lines[:height-room]
+	}
+
+	log := &screen{width: width}
+	log.print(bold, "EVENTS")
+	log.newline()
+	if len(events) > room-1 {
+		events = events[len(events)-(room-1):]
+	}
+	for _, e := range events {
+		log.print(dim, e.Time.Format("15:04:05"))
+		log.print(colourOfAction(e.Action), fmt.Sprintf(" %-7v", e.Action))
+		log.print("", fmt.Sprintf(" %v %v", e.Type, e.Name))
+		log.newline()
+	}
+
+	for _, line := range append(lines, log.lines...) {
+		io.WriteString(w, line+"\n")
+	}
+}
+
+func nodes(s *screen, snapshot model.DSnapshot) {
+	s.print(bold, "NODES")
+	s.newline()
+	tasks := make(map[string][]model.DTask)
+	for _, t := range snapshot.Tasks {
+		tasks[t.NodeId] = append(tasks[t.NodeId], t)
+	}
+	sorted := append([]model.DNode{}, snapshot.Nodes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	for _, n := range sorted {
+		s.print(blue, " "+n.Name)
+		s.print(dim, fmt.Sprintf("  %v %v %v", n.Role, n.State, n.Availability))
+		s.newline()
+		onNode := tasks[n.Id]
+		sort.Slice(onNode, func(i, j int) bool {
+			return onNode[i].Name < onNode[j].Name
+		})
+		if len(onNode) == 0 {
+			continue
+		}
+		s.print("", "  ")
+		for _, t := range onNode {
+			item := fmt.Sprintf(" ● %v %v", t.Name, t.Status)
+			if !s.fits(item) && s.visible > 2 {
+				s.newline()
+				s.print("", "  ")
+			}
+			s.print(colourOfTask(t.Status), item)
+		}
+		s.newline()
+	}
+}
+
+func services(s *screen, snapshot model.DSnapshot) {
+	s.print(bold, "SERVICES")
+	s.newline()
+	replicas := service.Replicas(snapshot.Services, snapshot.Tasks)
+	order := make([]int, len(replicas))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return replicas[order[i]].Name < replicas[order[j]].Name
+	})
+	for _, i := range order {
+		r := replicas[i]
+		s.print("", fmt.Sprintf(" %-30v %3v/%-3v ", r.Name, r.Running, r.Desired))
+		s.print(colourOfHealth(r.Health), fmt.Sprintf("%-9v", r.Health))
+		s.print(dim, " "+snapshot.Services[i].Image)
+		s.newline()
+	}
+}
+
+func colourOfTask(status string) string {
+	switch status {
+	case "running":
+		return green
+	case "new", "pending", "assigned", "accepted", "preparing", "starting":
+		return yellow
+	case "failed", "rejected", "orphaned", "shutdown", "complete":
+		return red
+	}
+	return ""
+}
+
+func colourOfHealth(health string) string {
+	switch health {
+	case "converged":
+		return green
+	case "degraded":
+		return yellow
+	}
+	return red
+}
+
+func colourOfAction(action model.Action) string {
+	switch action {
+	case model.ActionStart:
+		return green
+	case model.ActionStop, model.ActionPending, model.ActionUnused:
+		return red
+	}
+	return yellow
+}
+
+// screen collects lines of coloured text, cutting them at the width of the terminal.
+type screen struct {
+	width   int
+	lines   []string
+	current strings.Builder
+	visible int // characters on the current line, leaving out colour codes
+}
+
+func (s *screen) fits(text string) bool {
+	return s.visible+utf8.RuneCountInString(text) <= s.width
+}
+
+func (s *screen) print(colour string, text string) {
+	room := s.width - s.visible
+	if room <= 0 {
+		return
+	}
+	if utf8.RuneCountInString(text) > room {
+		text = string([]rune(text)[:room])
+	}
+	if colour != "" {
+		s.current.WriteString(colour + text + reset)
+	} else {
+		s.current.WriteString(text)
+	}
+	s.visible += utf8.RuneCountInString(text)
+}
+
+func (s *screen) newline() {
+	s.lines = append(s.lines, s.current.String())
+	s.current.Reset()
+	s.visible = 0
+}
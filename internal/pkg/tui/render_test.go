@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"bytes"
+	. "github.com/eriklupander/dvizz/pkg/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var colours = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func render(snapshot DSnapshot, events []Entry, width int, height int) []string {
+	var buf bytes.Buffer
+	Render(&buf, snapshot, events, time.Date(2019, 6, 12, 3, 12, 0, 0, time.UTC), width, height)
+	return strings.Split(strings.TrimSuffix(colours.ReplaceAllString(buf.String(), ""), "\n"), "\n")
+}
+
+func TestRender(t *testing.T) {
+	snapshot := DSnapshot{
+		Nodes: []DNode{{Id: "n1", Name: "manager1", Role: "manager", State: "ready", Availability: "active"}},
+		Services: []DService{
+			{Id: "s1", Name: "web", Mode: "replicated", Replicas: 2, Image: "nginx"},
+			{Id: "s2", Name: "db", Mode: "replicated", Replicas: 1, Image: "postgres"},
+		},
+		Tasks: []DTask{
+			{Id: "t1", Name: "web.1", ServiceId: "s1", NodeId: "n1", Status: "running"},
+			{Id: "t2", Name: "web.2", ServiceId: "s1", NodeId: "n1", Status: "starting"},
+		},
+	}
+	events := make([]Entry, 0)
+	for i := 0; i < 20; i++ {
+		events = append(events, Entry{Time: time.Now(), Type: "task", Action: ActionUpdate, Name: "web." + string('a'+rune(i))})
+	}
+
+	Convey("Given a large terminal", t, func() {
+		lines := render(snapshot, events, 120, 40)
+		text := strings.Join(lines, "\n")
+
+		Convey("Then nodes with their tasks, services with their health and the latest events are drawn", func() {
+			So(lines[0], ShouldStartWith, "dvizz  1 nodes  2 services  2 tasks  03:12:00")
+			So(text, ShouldContainSubstring, "manager1  manager ready active")
+			So(text, ShouldContainSubstring, "● web.1 running ● web.2 starting")
+			So(text, ShouldContainSubstring, "  1/2   degraded  nginx")
+			So(text, ShouldContainSubstring, "  0/1   failing   postgres")
+			So(strings.Index(text, " db "), ShouldBeLessThan, strings.Index(text, " web "))
+			So(lines[len(lines)-1], ShouldEndWith, "update  task web.t")
+			So(len(lines), ShouldBeLessThanOrEqualTo, 40)
+		})
+	})
+
+	Convey("Given a small terminal", t, func() {
+		lines := render(snapshot, events, 30, 10)
+
+		Convey("Then nothing is drawn outside of it, but a few events are", func() {
+			So(len(lines), ShouldEqual, 10)
+			for _, line := range lines {
+				So(utf8.RuneCountInString(line), ShouldBeLessThanOrEqualTo, 30)
+			}
+			So(lines[len(lines)-minEvents], ShouldEqual, "EVENTS")
+		})
+	})
+}
+
+func TestFeed(t *testing.T) {
+	Convey("Given a feed of a UI", t, func() {
+		ui := New(&bytes.Buffer{}, nil)
+		feed := Feed{UI: ui}
+
+		Convey("When events are published", func() {
+			feed.AddEventToSendQueue([]byte(`{"action":"start","type":"task","dtask":{"id":"t1","name":"web.1"}}`))
+			feed.AddEventToSendQueue([]byte(`{"action":"update","type":"stats","stats":{}}`))
+
+			Convey("Then they are logged, except resource usage", func() {
+				So(len(ui.events), ShouldEqual, 1)
+				So(ui.events[0].Name, ShouldEqual, "web.1")
+				So(ui.events[0].Action, ShouldEqual, ActionStart)
+			})
+		})
+	})
+}
+
+func TestReadKeys(t *testing.T) {
+	Convey("Given keys pressed", t, func() {
+		quit := make(chan bool, 1)
+		Convey("When q is pressed after others", func() {
+			ReadKeys(strings.NewReader("abq"), func() { quit <- true })
+			Convey("Then the UI quits", func() {
+				So(<-quit, ShouldBeTrue)
+			})
+		})
+		Convey("When Ctrl-C is pressed", func() {
+			in := strings.NewReader("\x03never read")
+			ReadKeys(in, func() { quit <- true })
+			Convey("Then the UI quits without reading further", func() {
+				So(<-quit, ShouldBeTrue)
+				So(in.Len(), ShouldEqual, len("never read"))
+			})
+		})
+	})
+}
@@ -0,0 +1,146 @@
+// Package tui is a terminal front end, drawing the cluster model and a log of its changes.
+package tui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/eriklupander/dvizz/internal/pkg/history"
+	"github.com/eriklupander/dvizz/pkg/client"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"io"
+	"sync"
+	"time"
+)
+
+// keptEvents is how many events the log keeps.
+const keptEvents = 500
+
+// Source is where the model drawn comes from, such as a publisher polling the local Docker client or a client of a
+// remote dvizz server.
+type Source interface {
+	Snapshot() model.DSnapshot
+}
+
+// UI draws the model of a source and the events added, whenever they change.
+type UI struct {
+	// Size tells the width and height of the terminal
+	Size func() (int, int)
+
+	out     io.Writer
+	source  Source
+	lock    sync.Mutex
+	events  []Entry
+	changed chan struct{}
+}
+
+func New(out io.Writer, source Source) *UI {
+	return &UI{
+		Size: func() (int, int) {
+			return 80, 24
+		},
+		out:     out,
+		source:  source,
+		events:  make([]Entry, 0),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Add logs an event and has the UI redrawn.
+func (u *UI) Add(e Entry) {
+	u.lock.Lock()
+	u.events = append(u.events, e)
+	if len(u.events) > keptEvents {
+		u.events = u.events[len(u.events)-keptEvents:]
+	}
+	u.lock.Unlock()
+	select {
+	case u.changed <- struct{}{}:
+	default: // a redraw is already due
+	}
+}
+
+// Run draws the UI on the alternate screen of the terminal until the context is done, redrawing when events are
+// added and at least every refresh.
+func (u *UI) Run(ctx context.Context, refresh time.Duration) {
+	io.WriteString(u.out, "\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+	defer io.WriteString(u.out, "\x1b[?25h\x1b[?1049l")
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		u.draw()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-u.changed:
+			time.Sleep(time.Millisecond * 100) // let the events of a poll cycle arrive
+		}
+	}
+}
+
+func (u *UI) draw() {
+	u.lock.Lock()
+	events := append([]Entry{}, u.events...)
+	u.lock.Unlock()
+
+	width, height := u.Size()
+	var buf bytes.Buffer
+	Render(&buf, u.source.Snapshot(), events, time.Now(), width, height)
+	// Overwrite from the top left, clearing what is left of each line and below the last one. Lines end in \r\n as
+	// the terminal is in raw mode.
+	frame := bytes.Replace(buf.Bytes(), []byte("\n"), []byte("\x1b[K\r\n"), -1)
+	frame = bytes.TrimSuffix(frame, []byte("\r\n"))
+	u.out.Write(append(append([]byte("\x1b[H"), frame...), []byte("\x1b[J")...))
+}
+
+// ReadKeys reads the keys pressed until q, Ctrl-C or Ctrl-D is, then calls quit. With the terminal in raw mode,
+// Ctrl-C is read as a key rather than sent as a signal.
+func ReadKeys(in io.Reader, quit func()) {
+	defer quit()
+	key := make([]byte, 1)
+	for {
+		if _, err := in.Read(key); err != nil {
+			return
+		}
+		switch key[0] {
+		case 'q', 'Q', 0x03, 0x04:
+			return
+		}
+	}
+}
+
+// Feed is the event server of a publisher running in process, adding the events published to the UI.
+type Feed struct {
+	UI *UI
+}
+
+func (f Feed) AddEventToSendQueue(data []byte) {
+	var event model.DHistoryEvent
+	if !history.Describe(data, &event) || event.Type == "stats" {
+		return
+	}
+	name := event.Name
+	if name == "" {
+		name = event.Entity
+	}
+	f.UI.Add(Entry{Time: time.Now(), Type: event.Type, Action: model.Action(event.Action), Name: name})
+}
+
+func (f Feed) InitializeEventSystem() {}
+
+func (f Feed) Close() {}
+
+// EntryOf describes a change received from a dvizz server for the event log.
+func EntryOf(e client.Event) Entry {
+	entity := struct {
+		Name string
+	}{}
+	json.Unmarshal(e.Payload, &entity)
+	name := entity.Name
+	if name == "" {
+		name = e.Id
+	}
+	return Entry{Time: e.Time, Type: e.Type, Action: e.Action, Name: name}
+}
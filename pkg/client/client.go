@@ -0,0 +1,425 @@
+// Package client consumes the events of a dvizz server, keeping a replica of its cluster model.
+//
+//	c, err := client.New("http://manager:6969")
+//	c.OnChange(func(e client.Event) {
+//		if e.Type == "task" && e.Action == client.ActionStop {
+//			log.Printf("task %v stopped", e.Id)
+//		}
+//	})
+//	err = c.Run(ctx)
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a change of the replica. Payload is the entity as sent by the server, to be decoded as Type tells, such
+// as a Task for events of type task. Events of type snapshot tell the replica was loaded anew and have no payload.
+type Event struct {
+	Seq     uint64
+	Time    time.Time
+	Type    string
+	Action  Action
+	Id      string
+	Payload json.RawMessage
+}
+
+// Client keeps a replica of the nodes, services, tasks and networks of a dvizz server. It loads a snapshot, applies
+// the events following it and, when the connection is lost, resumes from the last event received.
+type Client struct {
+	// Dialer connects to the event stream
+	Dialer *websocket.Dialer
+	// HTTPClient loads snapshots
+	HTTPClient *http.Client
+	// Retry is how long to wait before reconnecting
+	Retry time.Duration
+	// Logf reports the problems the client recovers from, such as a lost connection, by default with log.Printf
+	Logf func(format string, args ...interface{})
+
+	base     *url.URL
+	lock     sync.RWMutex
+	stream   string
+	seq      uint64
+	nodes    map[string]Node
+	services map[string]Service
+	tasks    map[string]Task
+	networks map[string]Network
+	handlers []func(Event)
+}
+
+// New creates a client of the dvizz server at the given address, such as http://manager:6969.
+func New(address string) (*Client, error) {
+	base, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q, expected http or https", base.Scheme)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	return &Client{
+		Dialer:     &websocket.Dialer{EnableCompression: true, HandshakeTimeout: time.Second * 10},
+		HTTPClient: &http.Client{Timeout: time.Second * 30},
+		Retry:      time.Second * 5,
+		Logf:       log.Printf,
+		base:       base,
+		nodes:      make(map[string]Node),
+		services:   make(map[string]Service),
+		tasks:      make(map[string]Task),
+		networks:   make(map[string]Network),
+	}, nil
+}
+
+// OnChange registers a handler called for every change of the replica, after it is applied. Handlers are called
+// one at a time, from the goroutine running the client.
+func (c *Client) OnChange(handler func(Event)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+// Run keeps the replica up to date until the context is done, reconnecting whenever the connection is lost.
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.Logf("lost connection to dvizz at %v, reconnecting in %v: %v", c.base, c.Retry, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.Retry):
+		}
+	}
+}
+
+// session connects once, resuming after the last event received if possible, and applies events until the
+// connection is lost.
+func (c *Client) session(ctx context.Context) error {
+	c.lock.RLock()
+	stream, since := c.stream, c.seq
+	c.lock.RUnlock()
+	conn, resp, err := c.dial(ctx, stream, since)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusGone {
+		// The events missed are no longer kept, so start over from a snapshot
+		since = 0
+		conn, _, err = c.dial(ctx, "", since)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	// Events sent while the snapshot loads wait on the connection, and those it lacks are applied on top of it
+	if since == 0 {
+		if err := c.Load(ctx); err != nil {
+			return err
+		}
+	}
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if err := c.receive(data); err != nil {
+			c.Logf("problem applying event: %v", err)
+		}
+	}
+}
+
+func (c *Client) dial(ctx context.Context, stream string, since uint64) (*websocket.Conn, *http.Response, error) {
+	address := *c.base
+	address.Path += "start"
+	switch address.Scheme {
+	case "https":
+		address.Scheme = "wss"
+	default:
+		address.Scheme = "ws"
+	}
+	query := url.Values{"batch": []string{"true"}}
+	if since > 0 {
+		query.Set("since", strconv.FormatUint(since, 10))
+	}
+	if stream != "" {
+		query.Set("stream", stream)
+	}
+	address.RawQuery = query.Encode()
+	return c.Dialer.DialContext(ctx, address.String(), nil)
+}
+
+// Load replaces the replica by a snapshot of the model. Run does so when it starts, so Load is only needed to look
+// at the model once without following its changes.
+func (c *Client) Load(ctx context.Context) error {
+	address := *c.base
+	address.Path += "api/snapshot"
+	req, err := http.NewRequest("GET", address.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("loading snapshot: %v", resp.Status)
+	}
+	var snapshot Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return err
+	}
+	// The last event the snapshot includes, zero if the server does not tell
+	seq, _ := strconv.ParseUint(resp.Header.Get("X-Dvizz-Seq"), 10, 64)
+
+	c.lock.Lock()
+	c.stream, c.seq = resp.Header.Get("X-Dvizz-Stream"), seq
+	c.nodes = make(map[string]Node)
+	for _, n := range snapshot.Nodes {
+		c.nodes[n.Id] = n
+	}
+	c.services = make(map[string]Service)
+	for _, s := range snapshot.Services {
+		c.services[s.Id] = s
+	}
+	c.tasks = make(map[string]Task)
+	for _, t := range snapshot.Tasks {
+		c.tasks[t.Id] = t
+	}
+	c.networks = make(map[string]Network)
+	for _, n := range snapshot.Networks {
+		c.networks[n.Id] = n
+	}
+	c.lock.Unlock()
+
+	c.notify(Event{Time: time.Now(), Type: "snapshot", Action: ActionUpdate})
+	return nil
+}
+
+// receive applies a message of the server, which may be a batch of events.
+func (c *Client) receive(data []byte) error {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	switch envelope.Type {
+	case "ping":
+		return nil
+	case "batch":
+		var events []json.RawMessage
+		if err := json.Unmarshal(envelope.Payload, &events); err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := c.receive(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	event, applied, err := c.apply(envelope)
+	if err != nil {
+		return err
+	}
+	if applied {
+		c.notify(event)
+	}
+	return nil
+}
+
+// apply changes the replica as an event tells, unless the replica already includes it. Events of other entities
+// than nodes, services, tasks and networks only advance the position in the stream.
+func (c *Client) apply(envelope Envelope) (Event, bool, error) {
+	event := Event{Seq: envelope.Seq, Time: envelope.Timestamp, Type: envelope.Type, Action: envelope.Action, Payload: envelope.Payload}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if envelope.Stream != c.stream {
+		c.stream, c.seq = envelope.Stream, 0
+	}
+	if envelope.Seq != 0 && envelope.Seq <= c.seq {
+		return event, false, nil
+	}
+	if envelope.Seq > c.seq {
+		c.seq = envelope.Seq
+	}
+	gone := envelope.Action == ActionStop
+
+	var err error
+	switch envelope.Type {
+	case "node":
+		var node Node
+		if err = json.Unmarshal(envelope.Payload, &node); err == nil {
+			event.Id = node.Id
+			if gone {
+				delete(c.nodes, node.Id)
+			} else {
+				c.nodes[node.Id] = node
+			}
+		}
+	case "service":
+		var service Service
+		if err = json.Unmarshal(envelope.Payload, &service); err == nil {
+			event.Id = service.Id
+			if gone {
+				delete(c.services, service.Id)
+			} else {
+				c.services[service.Id] = service
+			}
+		}
+	case "task":
+		var task Task
+		if err = json.Unmarshal(envelope.Payload, &task); err == nil {
+			event.Id = task.Id
+			if gone {
+				delete(c.tasks, task.Id)
+			} else if envelope.Action != ActionPending { // not placed on any node, so not part of the model
+				c.tasks[task.Id] = task
+			}
+		}
+	case "network":
+		var network Network
+		if err = json.Unmarshal(envelope.Payload, &network); err == nil {
+			event.Id = network.Id
+			if gone {
+				delete(c.networks, network.Id)
+			} else {
+				c.networks[network.Id] = network
+			}
+		}
+	default:
+		entity := struct {
+			Id   string
+			Name string
+		}{}
+		json.Unmarshal(envelope.Payload, &entity)
+		event.Id = entity.Id
+		if event.Id == "" {
+			event.Id = entity.Name
+		}
+	}
+	return event, true, err
+}
+
+func (c *Client) notify(event Event) {
+	c.lock.RLock()
+	handlers := c.handlers
+	c.lock.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Seq is the number of the last event applied, zero if none was.
+func (c *Client) Seq() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.seq
+}
+
+// Snapshot copies the replica.
+func (c *Client) Snapshot() Snapshot {
+	return Snapshot{Nodes: c.Nodes(), Services: c.Services(), Tasks: c.Tasks(), Networks: c.Networks()}
+}
+
+// Nodes lists the nodes of the replica, sorted by id.
+func (c *Client) Nodes() []Node {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	result := make([]Node, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		result = append(result, n)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+// Services lists the services of the replica, sorted by id.
+func (c *Client) Services() []Service {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	result := make([]Service, 0, len(c.services))
+	for _, s := range c.services {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+// Tasks lists the tasks of the replica, sorted by id.
+func (c *Client) Tasks() []Task {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	result := make([]Task, 0, len(c.tasks))
+	for _, t := range c.tasks {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+// Networks lists the networks of the replica, sorted by id.
+func (c *Client) Networks() []Network {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	result := make([]Network, 0, len(c.networks))
+	for _, n := range c.networks {
+		result = append(result, n)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+// Node looks up a node of the replica.
+func (c *Client) Node(id string) (Node, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	n, ok := c.nodes[id]
+	return n, ok
+}
+
+// Service looks up a service of the replica.
+func (c *Client) Service(id string) (Service, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	s, ok := c.services[id]
+	return s, ok
+}
+
+// Task looks up a task of the replica.
+func (c *Client) Task(id string) (Task, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	t, ok := c.tasks[id]
+	return t, ok
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/eriklupander/dvizz/pkg/model"
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer serves a snapshot and, for every connection to /start, the events the test lets it send.
+type fakeServer struct {
+	sync.Mutex
+	snapshot  Snapshot
+	seq       string // of the last event the snapshot includes
+	snapshots int
+	sessions  [][][]byte // the messages sent on each connection, which is closed after them
+	since     []string   // since asked for by each connection
+	streams   []string   // stream asked for by each connection
+	gone      bool       // answer connections resuming with 410
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch r.URL.Path {
+	case "/api/snapshot":
+		f.snapshots++
+		if f.seq != "" {
+			w.Header().Set("X-Dvizz-Stream", "run1")
+			w.Header().Set("X-Dvizz-Seq", f.seq)
+		}
+		data, _ := json.Marshal(&f.snapshot)
+		w.Write(data)
+	case "/start":
+		since := r.URL.Query().Get("since")
+		if since != "" && f.gone {
+			f.gone = false
+			http.Error(w, "gone", http.StatusGone)
+			return
+		}
+		f.since = append(f.since, since)
+		f.streams = append(f.streams, r.URL.Query().Get("stream"))
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if len(f.sessions) == 0 {
+			return // kept open without events
+		}
+		for _, message := range f.sessions[0] {
+			conn.WriteMessage(websocket.TextMessage, message)
+		}
+		f.sessions = f.sessions[1:]
+		conn.Close()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func envelope(seq uint64, typ string, action Action, payload interface{}) []byte {
+	data, _ := json.Marshal(payload)
+	message, _ := json.Marshal(&Envelope{Version: model.EnvelopeVersion, Seq: seq, Timestamp: time.Now(), Type: typ, Action: action, Payload: data})
+	return message
+}
+
+// streamed is like envelope, for a server telling its stream.
+func streamed(seq uint64, typ string, action Action, payload interface{}) []byte {
+	data, _ := json.Marshal(payload)
+	message, _ := json.Marshal(&Envelope{Version: model.EnvelopeVersion, Stream: "run1", Seq: seq, Timestamp: time.Now(), Type: typ, Action: action, Payload: data})
+	return message
+}
+
+func batch(events ...[]byte) []byte {
+	payload := make([]json.RawMessage, 0)
+	for _, e := range events {
+		payload = append(payload, e)
+	}
+	data, _ := json.Marshal(payload)
+	message, _ := json.Marshal(&Envelope{Version: model.EnvelopeVersion, Timestamp: time.Now(), Type: "batch", Action: ActionBatch, Payload: data})
+	return message
+}
+
+// run runs the client until it received the given number of changes.
+func run(c *Client, changes int) []Event {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	events := make([]Event, 0)
+	c.OnChange(func(e Event) {
+		events = append(events, e)
+		if len(events) == changes {
+			cancel()
+		}
+	})
+	c.Run(ctx)
+	return events
+}
+
+func TestClientResumesAfterLostConnection(t *testing.T) {
+	fake := &fakeServer{
+		snapshot: Snapshot{Nodes: []Node{{Id: "n1"}}, Tasks: []Task{{Id: "t1", Status: "running"}}},
+		sessions: [][][]byte{
+			{
+				batch(envelope(1, "task", ActionStart, Task{Id: "t2", Status: "starting"}), envelope(2, "node", ActionUpdate, Node{Id: "n1", State: "down"})),
+				envelope(0, "ping", ActionPing, nil),
+			},
+			{
+				envelope(3, "task", ActionStop, Task{Id: "t1"}),
+				envelope(4, "task", ActionPending, Task{Id: "t3"}),
+			},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	Convey("Given a client of a server losing the connection", t, func() {
+		c, err := New(server.URL)
+		So(err, ShouldBeNil)
+		c.Retry = time.Millisecond
+
+		Convey("When it runs", func() {
+			events := run(c, 5)
+
+			Convey("Then it resumes after the last event and has the changes applied", func() {
+				So(fake.snapshots, ShouldEqual, 1)
+				So(fake.since[:2], ShouldResemble, []string{"", "2"})
+				So(events[0].Type, ShouldEqual, "snapshot")
+				So(events[1].Id, ShouldEqual, "t2")
+				So(events[4].Action, ShouldEqual, ActionPending)
+				So(c.Seq(), ShouldEqual, 4)
+
+				tasks := c.Tasks()
+				So(len(tasks), ShouldEqual, 1)
+				So(tasks[0].Id, ShouldEqual, "t2")
+				node, ok := c.Node("n1")
+				So(ok, ShouldBeTrue)
+				So(node.State, ShouldEqual, "down")
+			})
+		})
+	})
+}
+
+func TestClientStartsOverWhenEventsAreGone(t *testing.T) {
+	fake := &fakeServer{
+		snapshot: Snapshot{Services: []Service{{Id: "s1"}}},
+		sessions: [][][]byte{
+			{envelope(7, "service", ActionStart, Service{Id: "s2"})},
+		},
+		gone: true,
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	Convey("Given a client of a server no longer keeping the events missed", t, func() {
+		c, err := New(server.URL)
+		So(err, ShouldBeNil)
+		c.Retry = time.Millisecond
+
+		Convey("When it runs", func() {
+			events := run(c, 3)
+
+			Convey("Then it loads a snapshot again", func() {
+				So(fake.snapshots, ShouldEqual, 2)
+				So(events[2].Type, ShouldEqual, "snapshot")
+				So(len(c.Services()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestClientSkipsEventsOfTheSnapshot(t *testing.T) {
+	fake := &fakeServer{
+		snapshot: Snapshot{Services: []Service{{Id: "s1", Replicas: 2}}},
+		seq:      "2",
+		sessions: [][][]byte{
+			{
+				streamed(1, "service", ActionStart, Service{Id: "s1", Replicas: 1}),
+				streamed(2, "service", ActionUpdate, Service{Id: "s1", Replicas: 2}),
+				streamed(3, "service", ActionStart, Service{Id: "s2"}),
+			},
+			{streamed(4, "service", ActionStop, Service{Id: "s2"})},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	Convey("Given a client receiving events sent before the snapshot was taken", t, func() {
+		c, err := New(server.URL)
+		So(err, ShouldBeNil)
+		c.Retry = time.Millisecond
+
+		Convey("When it runs", func() {
+			events := run(c, 3)
+
+			Convey("Then only the events following the snapshot are applied, and it resumes within the stream", func() {
+				So(events[1].Seq, ShouldEqual, 3)
+				So(fake.since[1], ShouldEqual, "3")
+				So(fake.streams[1], ShouldEqual, "run1")
+				service, _ := c.Service("s1")
+				So(service.Replicas, ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestNewRejectsOtherSchemes(t *testing.T) {
+	Convey("Given a websocket address", t, func() {
+		_, err := New("ws://manager:6969")
+		Convey("Then it is rejected", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
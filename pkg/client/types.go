@@ -0,0 +1,40 @@
+package client
+
+import "github.com/eriklupander/dvizz/pkg/model"
+
+// The types of the cluster model, as sent by the server.
+type (
+	Node     = model.DNode
+	Service  = model.DService
+	Task     = model.DTask
+	Network  = model.DSwarmNetwork
+	Secret   = model.DSecret
+	Config   = model.DConfig
+	Volume   = model.DVolume
+	Stack    = model.DStack
+	Edge     = model.DEdge
+	Job      = model.DJob
+	Snapshot = model.DSnapshot
+	Envelope = model.DEnvelope
+	Action   = model.Action
+)
+
+// The actions of events.
+const (
+	ActionStart   = model.ActionStart
+	ActionStop    = model.ActionStop
+	ActionUpdate  = model.ActionUpdate
+	ActionPending = model.ActionPending
+	ActionUnused  = model.ActionUnused
+	ActionError   = model.ActionError
+	ActionBatch   = model.ActionBatch
+	ActionPing    = model.ActionPing
+)
+
+// The actions of jobs.
+const (
+	ActionForceUpdate = model.ActionForceUpdate
+	ActionRollback    = model.ActionRollback
+	ActionPause       = model.ActionPause
+	ActionResume      = model.ActionResume
+)
@@ -0,0 +1,567 @@
+/**
+The MIT License (MIT)
+
+Copyright (c) 2016 ErikL
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Action tells what happened to the entity an event is about.
+type Action string
+
+const (
+	ActionStart   Action = "start"   // the entity appeared
+	ActionStop    Action = "stop"    // the entity is gone
+	ActionUpdate  Action = "update"  // the entity changed
+	ActionPending Action = "pending" // a task could not be placed yet
+	ActionUnused  Action = "unused"  // a secret is not referenced by any service
+	ActionError   Action = "error"   // a request of the subscriber failed
+	ActionBatch   Action = "batch"   // the message carries several events
+	ActionPing    Action = "ping"    // the connection is alive
+)
+
+// Actions that can be requested of a service through the API, as tracked by a DJob.
+const (
+	ActionForceUpdate Action = "forceupdate" // re-create all tasks of the service
+	ActionRollback    Action = "rollback"    // roll back to the previous spec
+	ActionPause       Action = "pause"       // declined, the Docker API cannot pause an update
+	ActionResume      Action = "resume"      // resume an update the swarm paused
+)
+
+type Identifier interface {
+	GetId() string
+}
+
+type DObject interface {
+	Equals(other Identifier) bool
+}
+
+type DEvent struct {
+	Action Action `json:"action"` // create or stop or update
+	Type   string `json:"type"`
+	Dtask  DTask  `json:"dtask"`
+}
+
+type DTaskStateUpdate struct {
+	Action  Action `json:"action"` // create or stop or update
+	Type    string `json:"type"`   // typically task
+	Id      string `json:"id"`
+	State   string `json:"state"`
+	Message string `json:"message"`
+	Err     string `json:"err"`
+	Dtask   DTask  `json:"dtask"`
+}
+
+type DNode struct {
+	Id               string             `json:"id"`
+	Name             string             `json:"name"`
+	State            string             `json:"state"`
+	Memory           string             `json:"memory"`
+	CPUs             string             `json:"cpus"`
+	Role             string             `json:"role"`         // manager or worker
+	Availability     string             `json:"availability"` // active, pause or drain
+	Manager          *DManagerStatus    `json:"manager,omitempty"`
+	Addr             string             `json:"addr"`
+	EngineVersion    string             `json:"engineVersion"`
+	OS               string             `json:"os"`
+	Architecture     string             `json:"architecture"`
+	Labels           map[string]string  `json:"labels"`
+	EngineLabels     map[string]string  `json:"engineLabels"`
+	Plugins          []DPlugin          `json:"plugins"`
+	GenericResources []DGenericResource `json:"genericResources"`
+	Capacity         DResources         `json:"capacity"`
+	Usage            DNodeUsage         `json:"usage"`
+}
+
+// DManagerStatus is only set on manager nodes.
+type DManagerStatus struct {
+	Leader       bool   `json:"leader"`
+	Reachability string `json:"reachability"`
+	Addr         string `json:"addr"`
+}
+
+type DPlugin struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// DGenericResource is a resource such as a GPU advertised by a node. Named resources have a value, discrete
+// resources a count.
+type DGenericResource struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value,omitempty"`
+	Count int64  `json:"count,omitempty"`
+}
+
+// DResources holds CPU and memory amounts, such as the reservations of a task or the capacity of a node.
+type DResources struct {
+	NanoCPUs    int64 `json:"nanoCpus"`
+	MemoryBytes int64 `json:"memoryBytes"`
+}
+
+// DNodeUsage sums up the resources of the tasks placed on a node.
+type DNodeUsage struct {
+	Reservations  DResources `json:"reservations"`
+	Limits        DResources `json:"limits"`
+	Allocatable   DResources `json:"allocatable"`   // capacity left after reservations
+	Overcommitted bool       `json:"overcommitted"` // limits exceed capacity
+}
+
+// DNodeCapacity is a line of the capacity report. Fits tells whether another replica of the service asked
+// about can be placed on the node.
+type DNodeCapacity struct {
+	NodeId   string     `json:"nodeId"`
+	Name     string     `json:"name"`
+	Capacity DResources `json:"capacity"`
+	Usage    DNodeUsage `json:"usage"`
+	Fits     *bool      `json:"fits,omitempty"`
+}
+
+type DNodeEvent struct {
+	Action Action `json:"action"` // create or stop or update
+	Type   string `json:"type"`
+	Dnode  DNode  `json:"dnode"`
+}
+
+func (d DNode) GetId() string {
+	return d.Id
+}
+
+func (d DNode) Equals(d2 Identifier) bool {
+	// log.Printf("About to compare DNode %v with %v: result %v", d.GetId(), d2.GetId(), d.GetId() == d2.GetId())
+
+	return d.GetId() == d2.GetId()
+}
+
+type DTask struct {
+	Id           string     `json:"id"`
+	Name         string     `json:"name"`
+	Status       string     `json:"status"`
+	DesiredState string     `json:"desiredState"`
+	Message      string     `json:"message"`
+	Err          string     `json:"err"`
+	ExitCode     *int       `json:"exitCode,omitempty"` // only known once a container has been created
+	ContainerId  string     `json:"containerId"`
+	Slot         int        `json:"slot"`
+	ServiceId    string     `json:"serviceId"`
+	Stack        string     `json:"stack"`
+	NodeId       string     `json:"nodeId"`
+	Digest       string     `json:"digest"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	Networks     []DNetwork `json:"networks"`
+	Reservations DResources `json:"reservations"`
+	Limits       DResources `json:"limits"`
+}
+
+type DNetwork struct {
+	Id        string   `json:"id"`
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"` // assigned to the task, in CIDR notation
+}
+
+func (d DTask) Equals(d2 Identifier) bool {
+	// log.Printf("About to compare DTask %v with %v: result %v", d.GetId(), d2.GetId(), d.GetId() == d2.GetId())
+	return d.GetId() == d2.GetId()
+}
+
+func (d DTask) GetId() string {
+	return d.Id
+}
+
+type DServiceEvent struct {
+	Action   Action   `json:"action"` // create or stop or destroy
+	Type     string   `json:"type"`
+	DService DService `json:"dservice"`
+}
+
+type DService struct {
+	Id           string            `json:"id"`
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Digest       string            `json:"digest"`
+	Mode         string            `json:"mode"`     // replicated or global
+	Replicas     uint64            `json:"replicas"` // desired replicas, replicated mode only
+	Ports        []DPort           `json:"ports"`
+	Labels       map[string]string `json:"labels"`
+	Stack        string            `json:"stack"`
+	Reservations DResources        `json:"reservations"`
+	Limits       DResources        `json:"limits"`
+	UpdateStatus *DUpdateStatus    `json:"updateStatus,omitempty"`
+}
+
+// DPort is a port published by a service.
+type DPort struct {
+	Protocol      string `json:"protocol"`
+	TargetPort    uint32 `json:"targetPort"`
+	PublishedPort uint32 `json:"publishedPort"`
+	PublishMode   string `json:"publishMode"`
+}
+
+// DUpdateStatus is the state of the latest update or rollback of a service.
+type DUpdateStatus struct {
+	State       string     `json:"state"`
+	Message     string     `json:"message"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+func (d DService) Equals(d2 Identifier) bool {
+	// log.Printf("About to compare DService %v with %v: result %v", d.GetId(), d2.GetId(), d.GetId() == d2.GetId())
+
+	return d.GetId() == d2.GetId()
+}
+
+func (d DService) GetId() string {
+	return d.Id
+}
+
+type DJobEvent struct {
+	Action Action `json:"action"` // start, update or stop
+	Type   string `json:"type"`   // typically job
+	Djob   DJob   `json:"djob"`
+}
+
+// DJob tracks a long-running operation (such as a forced update or rollback) issued through the API.
+type DJob struct {
+	Id          string         `json:"id"`
+	Action      Action         `json:"action"`
+	ServiceId   string         `json:"serviceId"`
+	State       string         `json:"state"` // running, completed or failed
+	UpdateState string         `json:"updateState"`
+	Message     string         `json:"message"`
+	Tasks       map[string]int `json:"tasks"` // task count per task state
+	Started     time.Time      `json:"started"`
+	Finished    *time.Time     `json:"finished,omitempty"`
+}
+
+func (d DJob) GetId() string {
+	return d.Id
+}
+
+// DLogLine is a single line of task output, streamed to subscribers of a task or service log.
+type DLogLine struct {
+	Type      string     `json:"type"` // typically log
+	TaskId    string     `json:"taskId"`
+	ServiceId string     `json:"serviceId"`
+	NodeId    string     `json:"nodeId"`
+	Stream    string     `json:"stream"` // stdout or stderr
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Line      string     `json:"line"`
+}
+
+type DStatsEvent struct {
+	Action Action                `json:"action"` // typically update
+	Type   string                `json:"type"`   // typically stats
+	Stats  map[string]DTaskStats `json:"stats"`  // keyed by task id
+}
+
+// DTaskStats is a sample of the resource usage of the container running a task.
+type DTaskStats struct {
+	TaskId      string    `json:"taskId"`
+	ContainerId string    `json:"containerId"`
+	NodeId      string    `json:"nodeId"`
+	CPUPercent  float64   `json:"cpuPercent"` // 100 per fully used CPU
+	MemoryUsage uint64    `json:"memoryUsage"`
+	MemoryLimit uint64    `json:"memoryLimit"`
+	NetworkRx   uint64    `json:"networkRx"`
+	NetworkTx   uint64    `json:"networkTx"`
+	BlockRead   uint64    `json:"blockRead"`
+	BlockWrite  uint64    `json:"blockWrite"`
+	Read        time.Time `json:"read"`
+}
+
+func (d DTaskStats) GetId() string {
+	return d.TaskId
+}
+
+type DNetworkEvent struct {
+	Action   Action        `json:"action"` // start, stop or update
+	Type     string        `json:"type"`   // typically network
+	Dnetwork DSwarmNetwork `json:"dnetwork"`
+}
+
+// DSwarmNetwork is a swarm scoped network together with the services attached to it.
+type DSwarmNetwork struct {
+	Id         string            `json:"id"`
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Scope      string            `json:"scope"`
+	Subnets    []DSubnet         `json:"subnets"`
+	Attachable bool              `json:"attachable"`
+	Ingress    bool              `json:"ingress"`
+	Internal   bool              `json:"internal"`
+	Labels     map[string]string `json:"labels"`
+	Services   []string          `json:"services"` // ids of attached services, sorted
+}
+
+type DSubnet struct {
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway"`
+}
+
+func (d DSwarmNetwork) GetId() string {
+	return d.Id
+}
+
+type DSecretEvent struct {
+	Action  Action  `json:"action"` // start, stop, update or unused
+	Type    string  `json:"type"`   // typically secret
+	Dsecret DSecret `json:"dsecret"`
+}
+
+// DSecret holds the metadata of a swarm secret. The value of a secret is never fetched.
+type DSecret struct {
+	Id        string            `json:"id"`
+	Name      string            `json:"name"`
+	Driver    string            `json:"driver"` // external secret store, if any
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Services  []string          `json:"services"` // ids of the services referencing the secret, sorted
+}
+
+func (d DSecret) GetId() string {
+	return d.Id
+}
+
+type DConfigEvent struct {
+	Action  Action  `json:"action"` // start, stop or update
+	Type    string  `json:"type"`   // typically config
+	Dconfig DConfig `json:"dconfig"`
+}
+
+// DConfig holds the metadata of a swarm config, leaving out its data.
+type DConfig struct {
+	Id        string            `json:"id"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Services  []string          `json:"services"` // ids of the services referencing the config, sorted
+}
+
+func (d DConfig) GetId() string {
+	return d.Id
+}
+
+type DVolumeEvent struct {
+	Action  Action  `json:"action"` // start, stop or update
+	Type    string  `json:"type"`   // typically volume
+	Dvolume DVolume `json:"dvolume"`
+}
+
+// DVolume is a named volume or bind mount used by services. Its id is the mount type and source, such as
+// volume:dbdata.
+type DVolume struct {
+	Id       string   `json:"id"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // volume or bind
+	Driver   string   `json:"driver"`
+	Services []string `json:"services"` // ids of the services mounting the volume, sorted
+}
+
+func (d DVolume) GetId() string {
+	return d.Id
+}
+
+type DStackEvent struct {
+	Action Action `json:"action"` // start, stop or update
+	Type   string `json:"type"`   // typically stack
+	Dstack DStack `json:"dstack"`
+}
+
+// DStack groups the services deployed together by docker stack deploy.
+type DStack struct {
+	Name     string          `json:"name"`
+	Health   string          `json:"health"` // converged, degraded or failing
+	Services []DStackService `json:"services"`
+}
+
+// DStackService tells how far a service of a stack is from its desired replicas.
+type DStackService struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Desired int    `json:"desired"`
+	Running int    `json:"running"`
+	Health  string `json:"health"` // converged, degraded or failing
+}
+
+func (d DStack) GetId() string {
+	return d.Name
+}
+
+type DEdgeEvent struct {
+	Action Action `json:"action"` // start, stop or update
+	Type   string `json:"type"`   // typically edge
+	Dedge  DEdge  `json:"dedge"`
+}
+
+// DServiceGraph tells which services can talk to each other, having an overlay network in common.
+type DServiceGraph struct {
+	Vertices []DVertex `json:"vertices"`
+	Edges    []DEdge   `json:"edges"`
+}
+
+// DVertex is a service in the service graph.
+type DVertex struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Stack string `json:"stack"`
+}
+
+// DEdge connects two services sharing one or more networks. Edges are undirected, Source being the lesser id.
+type DEdge struct {
+	Id       string         `json:"id"` // source and target joined by a dash
+	Source   string         `json:"source"`
+	Target   string         `json:"target"`
+	Networks []DEdgeNetwork `json:"networks"`
+}
+
+type DEdgeNetwork struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (d DEdge) GetId() string {
+	return d.Id
+}
+
+// DSnapshot is the cluster model as polled at one point in time.
+type DSnapshot struct {
+	Nodes    []DNode         `json:"nodes"`
+	Services []DService      `json:"services"`
+	Tasks    []DTask         `json:"tasks"`
+	Networks []DSwarmNetwork `json:"networks"`
+}
+
+// DHistoryEvent is a published event as kept in the history, with what it was about pulled out for querying.
+type DHistoryEvent struct {
+	Time    time.Time       `json:"time"`
+	Type    string          `json:"type"`
+	Action  string          `json:"action"`
+	Entity  string          `json:"entity"`  // id of the node, service, task etc. the event is about
+	Name    string          `json:"name"`    // name of the entity, if it has one
+	Service string          `json:"service"` // id of the service the entity belongs to, if any
+	Event   json.RawMessage `json:"event"`   // the event as published
+}
+
+// DError tells a subscriber why its request failed, such as a scrubbing subscriber asking for an invalid time.
+type DError struct {
+	Message string `json:"message"`
+}
+
+// DSnapshotDiff tells what was added, removed and changed between two snapshots.
+type DSnapshotDiff struct {
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Nodes    DNodesDiff    `json:"nodes"`
+	Services DServicesDiff `json:"services"`
+	Tasks    DTasksDiff    `json:"tasks"`
+	Networks DNetworksDiff `json:"networks"`
+}
+
+type DNodesDiff struct {
+	Added   []DNode   `json:"added"`
+	Removed []DNode   `json:"removed"`
+	Changed []DChange `json:"changed"`
+}
+
+type DServicesDiff struct {
+	Added   []DService `json:"added"`
+	Removed []DService `json:"removed"`
+	Changed []DChange  `json:"changed"`
+}
+
+type DTasksDiff struct {
+	Added   []DTask   `json:"added"`
+	Removed []DTask   `json:"removed"`
+	Changed []DChange `json:"changed"`
+}
+
+type DNetworksDiff struct {
+	Added   []DSwarmNetwork `json:"added"`
+	Removed []DSwarmNetwork `json:"removed"`
+	Changed []DChange       `json:"changed"`
+}
+
+// DChange lists the fields changed of an entity.
+type DChange struct {
+	Id     string         `json:"id"`
+	Name   string         `json:"name"`
+	Fields []DFieldChange `json:"fields"`
+}
+
+// DFieldChange is the old and new value of one field, by its JSON name.
+type DFieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+// DSnapshotInfo identifies a stored snapshot.
+type DSnapshotInfo struct {
+	Id   string    `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// Asserts
+var _ Identifier = (*DService)(nil)
+var _ Identifier = (*DTask)(nil)
+var _ Identifier = (*DNode)(nil)
+var _ Identifier = (*DJob)(nil)
+var _ Identifier = (*DTaskStats)(nil)
+var _ Identifier = (*DSwarmNetwork)(nil)
+var _ Identifier = (*DSecret)(nil)
+var _ Identifier = (*DConfig)(nil)
+var _ Identifier = (*DVolume)(nil)
+var _ Identifier = (*DStack)(nil)
+var _ Identifier = (*DEdge)(nil)
+var _ DObject = (*DService)(nil)
+var _ DObject = (*DTask)(nil)
+var _ DObject = (*DNode)(nil)
+
+// DBatchEvent carries the events of one poll cycle to subscribers that asked for batches, in the order published.
+type DBatchEvent struct {
+	Action Action            `json:"action"` // typically batch
+	Type   string            `json:"type"`   // typically batch
+	Events []json.RawMessage `json:"events"`
+}
+
+// EnvelopeVersion is the version of the event envelope, bumped on changes that break consumers.
+const EnvelopeVersion = 2
+
+// DEnvelope is how events are sent to subscribers. Payload is the entity the event is about, or for a batch the
+// enveloped events. Seq increases with every event sent, so subscribers of a single stack will see gaps. It starts
+// over with every run of dvizz, which Stream identifies.
+type DEnvelope struct {
+	Version   int             `json:"version"`
+	Stream    string          `json:"stream,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	Type      string          `json:"type"`
+	Action    Action          `json:"action"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}